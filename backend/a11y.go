@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CheckAccessibility reports WCAG problems in a transpiled document. It looks
+// at the HTML names, so it sees elements produced by passes too; messages are
+// in German and name the element as it was written in the source.
+func CheckAccessibility(doc *Document) []Diagnostic {
+	var diagnostics []Diagnostic
+	report := func(severity Severity, code string, pos Position, format string, args ...interface{}) {
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: severity,
+			Code:     "a11y/" + code,
+			Message:  fmt.Sprintf(format, args...),
+			Pos:      pos,
+		})
+	}
+
+	// Labels can point at a control from anywhere in the document
+	labelled := map[string]bool{}
+	ids := map[string]*Element{}
+	walkElements(doc, func(e *Element, ancestors []*Element) {
+		if target, _ := e.GetAttribute("for"); e.TagName == "label" && target != "" {
+			labelled[target] = true
+		}
+	})
+
+	walkElements(doc, func(e *Element, ancestors []*Element) {
+		if id, _ := e.GetAttribute("id"); id != "" {
+			if first, exists := ids[id]; exists {
+				where := ""
+				if first.Pos.IsValid() {
+					where = " in " + first.Pos.String()
+				}
+				report(SEVERITY_ERROR, "duplicate-id", e.Pos,
+					"Die ID %q ist doppelt vergeben, zuerst bei <%s>%s (WCAG 4.1.1)", id, first.SourceName, where)
+			} else {
+				ids[id] = e
+			}
+		}
+
+		switch e.TagName {
+		case "html":
+			if lang, _ := e.GetAttribute("lang"); strings.TrimSpace(lang) == "" {
+				report(SEVERITY_ERROR, "html-lang", e.Pos,
+					"<%s> hat kein Sprachattribut (lang), Screenreader kennen die Sprache nicht (WCAG 3.1.1)", e.SourceName)
+			}
+		case "img":
+			if _, exists := e.GetAttribute("alt"); !exists {
+				report(SEVERITY_ERROR, "img-alt", e.Pos,
+					"<%s> hat keinen Alternativtext (alt); für dekorative Bilder alt=\"\" setzen (WCAG 1.1.1)", e.SourceName)
+			}
+		case "input", "select", "textarea":
+			if needsLabel(e) && !hasLabel(e, ancestors, labelled) {
+				report(SEVERITY_ERROR, "input-label", e.Pos,
+					"<%s> hat keine zugeordnete Beschriftung (label) (WCAG 1.3.1, 4.1.2)", e.SourceName)
+			}
+		case "table":
+			if !containsTag(e, "th") {
+				report(SEVERITY_WARNING, "table-header", e.Pos,
+					"<%s> hat keine Kopfzellen (th), Datentabellen brauchen Überschriften (WCAG 1.3.1)", e.SourceName)
+			}
+		}
+	})
+
+	sortDiagnostics(diagnostics)
+	return diagnostics
+}
+
+// needsLabel reports whether a form control is one users fill in
+func needsLabel(e *Element) bool {
+	if e.TagName != "input" {
+		return true
+	}
+	inputType, _ := e.GetAttribute("type")
+	switch strings.ToLower(inputType) {
+	case "hidden", "submit", "reset", "button", "image":
+		return false
+	}
+	return true
+}
+
+// hasLabel reports whether a form control has an accessible name
+func hasLabel(e *Element, ancestors []*Element, labelled map[string]bool) bool {
+	for _, name := range []string{"aria-label", "aria-labelledby", "title"} {
+		if value, _ := e.GetAttribute(name); strings.TrimSpace(value) != "" {
+			return true
+		}
+	}
+	if id, _ := e.GetAttribute("id"); id != "" && labelled[id] {
+		return true
+	}
+	for _, ancestor := range ancestors {
+		if ancestor.TagName == "label" {
+			return true
+		}
+	}
+	return false
+}
+
+// containsTag reports whether an element has a descendant with the given HTML name
+func containsTag(e *Element, tag string) bool {
+	found := false
+	Inspect(e, func(node Node) bool {
+		if child, ok := node.(*Element); ok && child != e && child.TagName == tag {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
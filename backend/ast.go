@@ -23,55 +23,142 @@ func (d *Document) String() string {
 	return result.String()
 }
 
+// NameKind records how a tag or attribute name was resolved by the dictionary
+type NameKind int
+
+const (
+	NAME_UNKNOWN     NameKind = iota // not in the dictionary and not a known HTML name
+	NAME_TRANSLATED                  // German name translated to its HTML equivalent
+	NAME_PASSTHROUGH                 // English/HTML name used as-is
+)
+
+// String returns a string representation of the name kind
+func (k NameKind) String() string {
+	switch k {
+	case NAME_TRANSLATED:
+		return "translated"
+	case NAME_PASSTHROUGH:
+		return "passthrough"
+	default:
+		return "unknown"
+	}
+}
+
 // Element represents an HTML element
 type Element struct {
-	TagName    string
-	Attributes map[string]string
-	Children   []Node
+	SourceName  string       // name as written in the source, e.g. "überschrift1"
+	TagName     string       // resolved HTML name, e.g. "h1"
+	Kind        NameKind
+	Attributes  []*Attribute // in source order
+	Children    []Node
 	SelfClosing bool
+	Pos         Position // position of the opening '<'
+	End         Position // just after the closing '>', for parsed elements
+}
+
+// Attribute represents an HTML attribute
+type Attribute struct {
+	SourceName string // name as written in the source, e.g. "klasse"
+	Name       string // resolved HTML name, e.g. "class"
+	Kind       NameKind
+	Value      string
+	Pos        Position
+	ValuePos   Position // where the value starts, after its quote
+}
+
+// valuePosition returns where the value starts, or the attribute's position
+// for attributes that were not parsed from a source
+func (a *Attribute) valuePosition() Position {
+	if a.ValuePos.IsValid() {
+		return a.ValuePos
+	}
+	return a.Pos
+}
+
+// GetAttribute returns the value of the attribute with the given HTML name
+func (e *Element) GetAttribute(name string) (string, bool) {
+	for _, attr := range e.Attributes {
+		if attr.Name == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// SetAttribute sets the attribute with the given HTML name, adding it if missing
+func (e *Element) SetAttribute(name, value string) {
+	for _, attr := range e.Attributes {
+		if attr.Name == name {
+			attr.Value = value
+			return
+		}
+	}
+	e.Attributes = append(e.Attributes, &Attribute{SourceName: name, Name: name, Kind: NAME_PASSTHROUGH, Value: value})
+}
+
+// RemoveAttribute removes the attribute with the given HTML name
+func (e *Element) RemoveAttribute(name string) {
+	kept := e.Attributes[:0]
+	for _, attr := range e.Attributes {
+		if attr.Name != name {
+			kept = append(kept, attr)
+		}
+	}
+	e.Attributes = kept
 }
 
 func (e *Element) String() string {
 	var result strings.Builder
+	result.WriteString(e.openTag())
+	if e.SelfClosing {
+		return result.String()
+	}
+	
+	// Children
+	for _, child := range e.Children {
+		result.WriteString(child.String())
+	}
+	
+	// Closing tag
+	result.WriteString("</")
+	result.WriteString(e.TagName)
+	result.WriteString(">")
+	
+	return result.String()
+}
+
+// openTag returns the opening tag as String writes it, "<name ...>" or
+// "<name ... />" for self-closing elements
+func (e *Element) openTag() string {
+	var result strings.Builder
 	
 	// Opening tag
 	result.WriteString("<")
 	result.WriteString(e.TagName)
 	
 	// Attributes
-	for name, value := range e.Attributes {
+	for _, attr := range e.Attributes {
 		result.WriteString(" ")
-		result.WriteString(name)
-		if value != "" {
+		result.WriteString(attr.Name)
+		if attr.Value != "" {
 			result.WriteString("=\"")
-			result.WriteString(value)
+			result.WriteString(attr.Value)
 			result.WriteString("\"")
 		}
 	}
 	
 	if e.SelfClosing {
 		result.WriteString(" />")
-		return result.String()
+	} else {
+		result.WriteString(">")
 	}
-	
-	result.WriteString(">")
-	
-	// Children
-	for _, child := range e.Children {
-		result.WriteString(child.String())
-	}
-	
-	// Closing tag
-	result.WriteString("</")
-	result.WriteString(e.TagName)
-	result.WriteString(">")
-	
 	return result.String()
 }
 
 // TextNode represents a text node
 type TextNode struct {
 	Content string
+	Pos     Position
 }
 
 func (t *TextNode) String() string {
@@ -81,6 +168,7 @@ func (t *TextNode) String() string {
 // CommentNode represents an HTML comment
 type CommentNode struct {
 	Content string
+	Pos     Position
 }
 
 func (c *CommentNode) String() string {
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Builder transpiles a source tree into an output tree with the same layout.
+// German HTML sources become .html files, every other file is copied as is.
+type Builder struct {
+	SourceDir  string
+	OutputDir  string
+	Transpiler *Transpiler // shared by all workers
+	Workers    int         // defaults to the number of CPUs
+	CheckLinks bool        // report links to files missing from the output
+
+	// Reload sets the transpiler up again when one of its ConfigFiles changes
+	// in watch mode; without it the transpiler is kept
+	Reload func() (*Transpiler, error)
+
+	graph *dependencyGraph // which pages read which other files, for watch mode
+}
+
+// BuildFile is the outcome for one file of a build
+type BuildFile struct {
+	Source       string // path relative to the source directory
+	Output       string // path relative to the output directory
+	Asset        bool   // copied rather than transpiled
+	Err          error
+	Diagnostics  []Diagnostic
+	Dependencies []string // absolute paths of other files the page read
+	Links        []Link   // link and asset targets of the page
+}
+
+// BuildReport summarises a build
+type BuildReport struct {
+	Files    []BuildFile // sorted by source path
+	Duration time.Duration
+}
+
+// Findings returns the number of diagnostics that are errors, such as broken links
+func (r *BuildReport) Findings() int {
+	n := 0
+	for _, file := range r.Files {
+		for _, diagnostic := range file.Diagnostics {
+			if diagnostic.Severity == SEVERITY_ERROR {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Pages returns the number of transpiled sources
+func (r *BuildReport) Pages() int {
+	return r.count(func(f BuildFile) bool { return !f.Asset && f.Err == nil })
+}
+
+// Assets returns the number of copied files
+func (r *BuildReport) Assets() int {
+	return r.count(func(f BuildFile) bool { return f.Asset && f.Err == nil })
+}
+
+// Failed returns the files that could not be built
+func (r *BuildReport) Failed() []BuildFile {
+	var failed []BuildFile
+	for _, file := range r.Files {
+		if file.Err != nil {
+			failed = append(failed, file)
+		}
+	}
+	return failed
+}
+
+func (r *BuildReport) count(match func(BuildFile) bool) int {
+	n := 0
+	for _, file := range r.Files {
+		if match(file) {
+			n++
+		}
+	}
+	return n
+}
+
+// Build builds every file below the source directory. Failing files are
+// recorded in the report and do not stop the build; the error is only set
+// when the source tree cannot be read at all.
+func (b *Builder) Build() (*BuildReport, error) {
+	files, err := b.sourceFiles()
+	if err != nil {
+		return nil, err
+	}
+	return b.BuildFiles(files), nil
+}
+
+// BuildFiles builds the given files, relative to the source directory, in parallel
+func (b *Builder) BuildFiles(files []string) *BuildReport {
+	start := time.Now()
+
+	workers := b.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs := make(chan string)
+	results := make(chan BuildFile)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range jobs {
+				results <- b.buildFile(rel)
+			}
+		}()
+	}
+	go func() {
+		for _, rel := range files {
+			jobs <- rel
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	if b.graph == nil {
+		b.graph = newDependencyGraph()
+	}
+
+	report := &BuildReport{}
+	for result := range results {
+		report.Files = append(report.Files, result)
+		// A failed page keeps its last dependencies, so fixing an include rebuilds it
+		if !result.Asset && result.Err == nil {
+			b.graph.update(result.Source, result.Dependencies)
+		}
+	}
+	sort.Slice(report.Files, func(i, j int) bool {
+		return report.Files[i].Source < report.Files[j].Source
+	})
+	if b.CheckLinks {
+		checkLinks(report, b.OutputDir)
+	}
+	report.Duration = time.Since(start)
+	return report
+}
+
+// buildFile transpiles or copies a single file
+func (b *Builder) buildFile(rel string) BuildFile {
+	result := BuildFile{Source: rel, Output: b.outputName(rel), Asset: !isSourceFile(rel)}
+	source := filepath.Join(b.SourceDir, rel)
+	output := filepath.Join(b.OutputDir, result.Output)
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		result.Err = err
+		return result
+	}
+
+	if result.Asset {
+		result.Err = copyFile(source, output)
+		return result
+	}
+
+	content, err := os.ReadFile(source)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	page, err := b.Transpiler.TranspileSource(source, string(content))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Diagnostics = page.Diagnostics
+	result.Dependencies = page.Dependencies
+	result.Links = collectLinks(page.Document, source)
+	if result.Err = os.WriteFile(output, []byte(page.HTML), 0644); result.Err == nil && page.SourceMap != nil {
+		result.Err = writeSourceMap(output, page.SourceMap)
+	}
+	return result
+}
+
+// outputName maps a source path to its output path: sources get .html, assets keep their name
+func (b *Builder) outputName(rel string) string {
+	if isSourceFile(rel) {
+		return strings.TrimSuffix(rel, filepath.Ext(rel)) + ".html"
+	}
+	return rel
+}
+
+// sourceFiles lists the files below the source directory, skipping hidden
+// files and the output directory when it lies inside the source tree
+func (b *Builder) sourceFiles() ([]string, error) {
+	outputDir, err := filepath.Abs(b.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := listFiles(b.SourceDir, outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading source directory: %w", err)
+	}
+	return files, nil
+}
+
+// listFiles lists the files below root relative to it, skipping hidden files
+// and directories and the directory skipDir, given as an absolute path
+func listFiles(root, skipDir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if abs, err := filepath.Abs(path); err == nil && abs == skipDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// copyFile copies a file, keeping its permission bits
+func copyFile(source, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// isIOError reports whether a build error came from the file system rather
+// than from transpiling
+func isIOError(err error) bool {
+	var pathErr *fs.PathError
+	return errors.As(err, &pathErr)
+}
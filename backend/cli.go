@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// version is the release version, overridden at build time with
+// -ldflags "-X main.version=..."
+var version = "1.0.0"
+
+// Exit codes shared by all commands
+const (
+	EXIT_OK       = 0
+	EXIT_FINDINGS = 1 // lint/a11y findings, unformatted files
+	EXIT_USAGE    = 2 // bad flags or arguments
+	EXIT_PARSE    = 3 // a source failed to parse or transpile
+	EXIT_IO       = 4 // a file could not be read or written, or config is invalid
+)
+
+// command is a CLI subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands lists the subcommands in the order the usage text shows them
+var commands []command
+
+func init() {
+	commands = []command{
+		{"transpile", "translate a German HTML file to HTML", runTranspile},
+		{"build", "transpile a directory tree into an output directory", runBuild},
+		{"site", "build a static site from a project directory", runSite},
+		{"serve", "start the HTTP API server", runServe},
+		{"fmt", "format German HTML sources in place", runFmt},
+		{"lint", "check German HTML sources for common problems", runLint},
+		{"a11y", "check transpiled pages for accessibility problems", runA11y},
+		{"dict", "list or look up dictionary entries", runDict},
+		{"grammar", "generate a syntax highlighting grammar from the dictionary", runGrammar},
+		{"lsp", "run a language server for editors on stdin and stdout", runLsp},
+		{"version", "print the version", runVersion},
+		{"help", "show this help", runHelp},
+	}
+}
+
+// runCLI dispatches to a subcommand and returns the exit code. Without
+// arguments it starts the server; a first argument that is not a command is
+// taken as a file to transpile, as in earlier versions.
+func runCLI(args []string) int {
+	if len(args) == 0 {
+		return runServe(nil)
+	}
+
+	name := args[0]
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(args[1:])
+		}
+	}
+
+	switch {
+	case name == "-h" || name == "--help":
+		return runHelp(nil)
+	case name == "-v" || name == "--version":
+		return runVersion(nil)
+	case strings.HasPrefix(name, "-"):
+		return runServe(args)
+	default:
+		return runTranspile(args)
+	}
+}
+
+func runHelp(args []string) int {
+	printUsage(os.Stdout)
+	return EXIT_OK
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "D.Ö.N.E.R - German HTML transpiler")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage: doner <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "doner <command> -h" for the flags of a command.`)
+}
+
+func runVersion(args []string) int {
+	fmt.Printf("doner %s (%s %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return EXIT_OK
+}
+
+// errorf prints an error to stderr and returns the given exit code
+func errorf(code int, format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "doner: "+format+"\n", args...)
+	return code
+}
+
+// parseFlags parses flags that may appear before, between or after the
+// positional arguments, so "doner build src -o dist" works, and returns the
+// positional arguments. "--" ends flag parsing.
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := flags.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// STDIN_NAME is how standard input appears in positions and messages
+const STDIN_NAME = "<stdin>"
+
+// readInput reads the named file, or standard input for "-"
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// inputName returns the name of an input path as shown in diagnostics
+func inputName(path string) string {
+	if path == "-" {
+		return STDIN_NAME
+	}
+	return path
+}
+
+// trackingWriter remembers the first write error, so callers can tell output
+// failures apart from errors of the producer
+type trackingWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+	return n, err
+}
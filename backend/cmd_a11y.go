@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// runA11y implements "doner a11y <file|dir|->..." and returns the exit code
+func runA11y(args []string) int {
+	flags := flag.NewFlagSet("a11y", flag.ContinueOnError)
+	configPath := flags.String("config", "", "config file with the passes to run (default doner.json)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doner a11y [--config file] <file|dir|->...")
+		flags.PrintDefaults()
+	}
+	paths, err := parseFlags(flags, args)
+	if err != nil {
+		return EXIT_USAGE
+	}
+	if len(paths) == 0 {
+		flags.Usage()
+		return EXIT_USAGE
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		return errorf(EXIT_IO, "loading config: %v", err)
+	}
+
+	// Check the transpiled document, after the configured passes have run
+	transpiler, err := config.NewTranspiler()
+	if err != nil {
+		return errorf(EXIT_IO, "loading config: %v", err)
+	}
+	transpiler.AddCheck(CheckAccessibility)
+
+	files, err := collectSourceFiles(paths)
+	if err != nil {
+		return errorf(EXIT_IO, "%v", err)
+	}
+
+	exitCode := EXIT_OK
+	for _, file := range files {
+		content, err := readInput(file)
+		if err != nil {
+			errorf(EXIT_IO, "reading file: %v", err)
+			exitCode = max(exitCode, EXIT_IO)
+			continue
+		}
+
+		result, err := transpiler.TranspileSource(inputName(file), string(content))
+		if err != nil {
+			diagnostic := DiagnosticFromError(err)
+			diagnostic.Pos.File = inputName(file)
+			fmt.Println(diagnostic)
+			exitCode = max(exitCode, EXIT_PARSE)
+			continue
+		}
+		for _, diagnostic := range result.Diagnostics {
+			fmt.Println(diagnostic)
+			if diagnostic.Severity != SEVERITY_INFO {
+				exitCode = max(exitCode, EXIT_FINDINGS)
+			}
+		}
+	}
+	return exitCode
+}
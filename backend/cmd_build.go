@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runBuild implements "doner build <src> -o <dist>"
+func runBuild(args []string) int {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	var options transpileFlags
+	options.register(flags)
+	output := flags.String("o", "dist", "output directory")
+	workers := flags.Int("jobs", 0, "number of parallel workers (default: number of CPUs)")
+	watch := flags.Bool("watch", false, "keep running and rebuild changed files and their dependents")
+	interval := flags.Duration("interval", DEFAULT_WATCH_INTERVAL, "how often --watch polls for changes")
+	links := flags.Bool("check-links", true, "report links and assets missing from the output")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doner build [flags] <source-dir> [-o output-dir]")
+		flags.PrintDefaults()
+	}
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return EXIT_USAGE
+	}
+	if len(positional) != 1 {
+		flags.Usage()
+		return EXIT_USAGE
+	}
+
+	transpiler, _, code := options.newTranspiler()
+	if code != EXIT_OK {
+		return code
+	}
+
+	builder := &Builder{
+		SourceDir:  positional[0],
+		OutputDir:  *output,
+		Transpiler: transpiler,
+		Workers:    *workers,
+		CheckLinks: *links,
+	}
+	if *watch {
+		builder.Reload = func() (*Transpiler, error) {
+			transpiler, _, code := options.newTranspiler()
+			if code != EXIT_OK {
+				return nil, errors.New("keeping the previous configuration")
+			}
+			return transpiler, nil
+		}
+		return watchBuild(builder, *interval)
+	}
+
+	report, err := builder.Build()
+	if err != nil {
+		return errorf(EXIT_IO, "%v", err)
+	}
+	return printBuildReport(report)
+}
+
+// watchBuild rebuilds on every change until interrupted
+func watchBuild(builder *Builder, interval time.Duration) int {
+	stop := make(chan struct{})
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		close(stop)
+	}()
+
+	fmt.Printf("Watching %s for changes (Ctrl+C to stop)\n", builder.SourceDir)
+	err := builder.Watch(interval, stop, func(report *BuildReport) {
+		fmt.Printf("[%s] ", time.Now().Format("15:04:05"))
+		printBuildReport(report)
+	})
+	if err != nil {
+		return errorf(EXIT_IO, "%v", err)
+	}
+	return EXIT_OK
+}
+
+// printBuildReport prints per-file problems and a summary line and returns the exit code
+func printBuildReport(report *BuildReport) int {
+	exitCode := EXIT_OK
+	for _, file := range report.Files {
+		for _, diagnostic := range file.Diagnostics {
+			fmt.Fprintln(os.Stderr, diagnostic)
+		}
+		if file.Err == nil {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "✗ %s: %v\n", file.Source, file.Err)
+		if isIOError(file.Err) {
+			exitCode = max(exitCode, EXIT_IO)
+		} else {
+			exitCode = max(exitCode, EXIT_PARSE)
+		}
+	}
+
+	findings := report.Findings()
+	if findings > 0 {
+		exitCode = max(exitCode, EXIT_FINDINGS)
+	}
+
+	failed := len(report.Failed())
+	fmt.Printf("Built %d pages and copied %d assets in %s", report.Pages(), report.Assets(), report.Duration.Round(1e6))
+	if failed > 0 {
+		fmt.Printf(", %d failed", failed)
+	}
+	if findings > 0 {
+		fmt.Printf(", %d problems", findings)
+	}
+	fmt.Println()
+	return exitCode
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// runDict implements "doner dict [--json] [--config file] [--dict file] [name...]"
+func runDict(args []string) int {
+	flags := flag.NewFlagSet("dict", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the dictionary as JSON")
+	configPath := flags.String("config", "", "config file naming the dictionary (default doner.json)")
+	dictionaryPath := flags.String("dict", "", "JSON file with extra dictionary entries, instead of the configured one")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doner dict [--json] [--config file] [--dict file] [name...]")
+		fmt.Fprintln(flags.Output(), "Without names, lists all tags and attributes; with names, looks them up in both directions.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+
+	dictionary, code := loadDictionaryFlags(*configPath, *dictionaryPath)
+	if code != EXIT_OK {
+		return code
+	}
+
+	if flags.NArg() == 0 {
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(dictionaryFile{Tags: dictionary.tags, Attributes: dictionary.attributes})
+			return EXIT_OK
+		}
+		fmt.Println("Tags:")
+		printMappings(dictionary.tags, "<%s>")
+		fmt.Println()
+		fmt.Println("Attributes:")
+		printMappings(dictionary.attributes, "%s")
+		return EXIT_OK
+	}
+
+	exitCode := EXIT_OK
+	for _, name := range flags.Args() {
+		found := false
+		if html, kind := dictionary.LookupTag(name); kind != NAME_UNKNOWN {
+			fmt.Printf("<%s> → <%s> (tag, %s)\n", name, html, kind)
+			found = true
+		}
+		if german, exists := dictionary.GermanTag(name); exists {
+			fmt.Printf("<%s> ← <%s> (tag)\n", name, german)
+			found = true
+		}
+		if html, kind := dictionary.LookupAttribute(name); kind != NAME_UNKNOWN {
+			fmt.Printf("%s → %s (attribute, %s)\n", name, html, kind)
+			found = true
+		}
+		if german, exists := dictionary.GermanAttribute(name); exists {
+			fmt.Printf("%s ← %s (attribute)\n", name, german)
+			found = true
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr, "%s: not in the dictionary\n", name)
+			exitCode = EXIT_FINDINGS
+		}
+	}
+	return exitCode
+}
+
+// loadDictionaryFlags loads the dictionary named by the config file, or the
+// --dict file instead, and returns an exit code on failure
+func loadDictionaryFlags(configPath, dictionaryPath string) (*Dictionary, int) {
+	config, err := loadConfigFlag(configPath)
+	if err != nil {
+		return nil, errorf(EXIT_IO, "loading config: %v", err)
+	}
+	if dictionaryPath != "" {
+		config.Dictionary = dictionaryPath
+	}
+	dictionary, err := config.LoadDictionary()
+	if err != nil {
+		return nil, errorf(EXIT_IO, "%v", err)
+	}
+	return dictionary, EXIT_OK
+}
+
+// printMappings prints German → HTML pairs sorted by German name
+func printMappings(mappings map[string]string, format string) {
+	names := make([]string, 0, len(mappings))
+	for german := range mappings {
+		names = append(names, german)
+	}
+	sort.Strings(names)
+	for _, german := range names {
+		fmt.Printf("  %-22s %s\n", fmt.Sprintf(format, german), fmt.Sprintf(format, mappings[german]))
+	}
+}
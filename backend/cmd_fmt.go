@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sourceExtensions are the file extensions recognised as German HTML sources
+var sourceExtensions = []string{".dhtml", ".doner"}
+
+// isSourceFile reports whether path has a German HTML extension
+func isSourceFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, sourceExt := range sourceExtensions {
+		if ext == sourceExt {
+			return true
+		}
+	}
+	return false
+}
+
+// runFmt implements "doner fmt [--check] [--diff] [--config file] <file|dir>..." and returns the exit code
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	check := flags.Bool("check", false, "list files whose formatting differs and exit 1, without writing")
+	showDiff := flags.Bool("diff", false, "print a unified diff instead of rewriting files")
+	configPath := flags.String("config", "", "config file naming the dictionary (default doner.json)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doner fmt [--check] [--diff] [--config file] [file|dir|-]...")
+		fmt.Fprintln(flags.Output(), "Without arguments, or for -, formats standard input to standard output.")
+		flags.PrintDefaults()
+	}
+	paths, err := parseFlags(flags, args)
+	if err != nil {
+		return EXIT_USAGE
+	}
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		return errorf(EXIT_IO, "loading config: %v", err)
+	}
+	dictionary, err := config.LoadDictionary()
+	if err != nil {
+		return errorf(EXIT_IO, "%v", err)
+	}
+
+	files, err := collectSourceFiles(paths)
+	if err != nil {
+		return errorf(EXIT_IO, "%v", err)
+	}
+
+	exitCode := EXIT_OK
+	for _, file := range files {
+		content, err := readInput(file)
+		if err != nil {
+			errorf(EXIT_IO, "reading input: %v", err)
+			exitCode = max(exitCode, EXIT_IO)
+			continue
+		}
+
+		formatted, err := FormatSource(string(content), dictionary)
+		if err != nil {
+			errorf(EXIT_PARSE, "%s: %v", inputName(file), err)
+			exitCode = max(exitCode, EXIT_PARSE)
+			continue
+		}
+
+		// Standard input is always echoed, formatted or not
+		if file == "-" && !*check && !*showDiff {
+			fmt.Print(formatted)
+			continue
+		}
+		if formatted == string(content) {
+			continue
+		}
+
+		switch {
+		case *showDiff:
+			fmt.Print(unifiedDiff(inputName(file)+".orig", inputName(file), string(content), formatted))
+			if *check {
+				exitCode = max(exitCode, EXIT_FINDINGS)
+			}
+		case *check:
+			fmt.Println(inputName(file))
+			exitCode = max(exitCode, EXIT_FINDINGS)
+		default:
+			if err := os.WriteFile(file, []byte(formatted), 0644); err != nil {
+				errorf(EXIT_IO, "writing file: %v", err)
+				exitCode = max(exitCode, EXIT_IO)
+			}
+		}
+	}
+	return exitCode
+}
+
+// collectSourceFiles expands directories into the German HTML files they
+// contain; "-" for standard input is passed through
+func collectSourceFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		if path == "-" {
+			files = append(files, path)
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && isSourceFile(file) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
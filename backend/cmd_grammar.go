@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runGrammar implements "doner grammar [--format textmate|vim] [--config file] [--dict file] [-o file]"
+func runGrammar(args []string) int {
+	flags := flag.NewFlagSet("grammar", flag.ContinueOnError)
+	format := flags.String("format", GRAMMAR_TEXTMATE, "grammar format: textmate or vim")
+	configPath := flags.String("config", "", "config file naming the dictionary (default doner.json)")
+	dictionaryPath := flags.String("dict", "", "JSON file with extra dictionary entries, instead of the configured one")
+	output := flags.String("o", "", "output file (default stdout)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doner grammar [--format textmate|vim] [--config file] [--dict file] [-o file]")
+		fmt.Fprintln(flags.Output(), "Generates a syntax highlighting grammar from the dictionary.")
+		flags.PrintDefaults()
+	}
+	if _, err := parseFlags(flags, args); err != nil {
+		return EXIT_USAGE
+	}
+
+	dictionary, code := loadDictionaryFlags(*configPath, *dictionaryPath)
+	if code != EXIT_OK {
+		return code
+	}
+
+	var grammar []byte
+	switch *format {
+	case GRAMMAR_TEXTMATE:
+		var err error
+		if grammar, err = TextMateGrammar(dictionary); err != nil {
+			return errorf(EXIT_IO, "%v", err)
+		}
+	case GRAMMAR_VIM:
+		grammar = []byte(VimSyntax(dictionary))
+	default:
+		return errorf(EXIT_USAGE, "unknown format %q (want %s or %s)", *format, GRAMMAR_TEXTMATE, GRAMMAR_VIM)
+	}
+
+	if *output == "" {
+		os.Stdout.Write(grammar)
+		return EXIT_OK
+	}
+	if err := os.WriteFile(*output, grammar, 0644); err != nil {
+		return errorf(EXIT_IO, "writing output: %v", err)
+	}
+	return EXIT_OK
+}
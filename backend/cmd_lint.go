@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// runLint implements "doner lint [--config file] <file|dir>..." and returns the exit code
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	configPath := flags.String("config", "", "config file with lint rule settings (default doner.json)")
+	listRules := flags.Bool("rules", false, "list the available rules and exit")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doner lint [--config file] <file|dir|->...")
+		flags.PrintDefaults()
+	}
+	paths, err := parseFlags(flags, args)
+	if err != nil {
+		return EXIT_USAGE
+	}
+
+	if *listRules {
+		for _, rule := range LintRules() {
+			fmt.Printf("%-22s %-8s %s\n", rule.Name, rule.Severity, rule.Description)
+		}
+		return EXIT_OK
+	}
+	if len(paths) == 0 {
+		flags.Usage()
+		return EXIT_USAGE
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		return errorf(EXIT_IO, "loading config: %v", err)
+	}
+	linter, err := NewLinter(config.Lint)
+	if err != nil {
+		return errorf(EXIT_IO, "loading config: %v", err)
+	}
+	dictionary, err := config.LoadDictionary()
+	if err != nil {
+		return errorf(EXIT_IO, "%v", err)
+	}
+	linter.SetDictionary(dictionary)
+
+	files, err := collectSourceFiles(paths)
+	if err != nil {
+		return errorf(EXIT_IO, "%v", err)
+	}
+
+	exitCode := EXIT_OK
+	for _, file := range files {
+		content, err := readInput(file)
+		if err != nil {
+			errorf(EXIT_IO, "reading file: %v", err)
+			exitCode = max(exitCode, EXIT_IO)
+			continue
+		}
+
+		for _, diagnostic := range linter.LintSource(inputName(file), string(content)) {
+			fmt.Println(diagnostic)
+			switch {
+			case diagnostic.Code == "syntax":
+				exitCode = max(exitCode, EXIT_PARSE)
+			case diagnostic.Severity != SEVERITY_INFO:
+				exitCode = max(exitCode, EXIT_FINDINGS)
+			}
+		}
+	}
+	return exitCode
+}
+
+// loadConfigFlag loads the config named by a --config flag, or the default config
+func loadConfigFlag(path string) (*Config, error) {
+	if path != "" {
+		return LoadConfig(path)
+	}
+	return loadDefaultConfig()
+}
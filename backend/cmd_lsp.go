@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runLsp implements "doner lsp [--config file]": a language server for
+// editors, speaking the Language Server Protocol on stdin and stdout
+func runLsp(args []string) int {
+	flags := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	configPath := flags.String("config", "", "config file with lint rule settings and dictionary (default doner.json)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doner lsp [--config file]")
+		fmt.Fprintln(flags.Output(), "Serves the Language Server Protocol on standard input and output; start it from an editor.")
+		flags.PrintDefaults()
+	}
+	if _, err := parseFlags(flags, args); err != nil {
+		return EXIT_USAGE
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		return errorf(EXIT_IO, "loading config: %v", err)
+	}
+	linter, err := NewLinter(config.Lint)
+	if err != nil {
+		return errorf(EXIT_IO, "loading config: %v", err)
+	}
+	dictionary, err := config.LoadDictionary()
+	if err != nil {
+		return errorf(EXIT_IO, "%v", err)
+	}
+	linter.SetDictionary(dictionary)
+
+	if err := newLSPServer(os.Stdin, os.Stdout, linter, dictionary).run(); err != nil {
+		return errorf(EXIT_IO, "lsp: %v", err)
+	}
+	return EXIT_OK
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// runSite implements "doner site [flags] [project-dir]"
+func runSite(args []string) int {
+	flags := flag.NewFlagSet("site", flag.ContinueOnError)
+	var options transpileFlags
+	options.register(flags)
+	output := flags.String("o", "", "output directory (default: site.output from the config, or dist)")
+	links := flags.Bool("check-links", true, "report links and assets missing from the output")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doner site [flags] [project-dir]")
+		fmt.Fprintln(flags.Output(), "Builds the pages in inhalt/ with the layouts in vorlagen/ and copies statisch/; see the \"site\" section of doner.json.")
+		flags.PrintDefaults()
+	}
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return EXIT_USAGE
+	}
+	if len(positional) > 1 {
+		flags.Usage()
+		return EXIT_USAGE
+	}
+	dir := "."
+	if len(positional) == 1 {
+		dir = positional[0]
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return errorf(EXIT_IO, "%v", err)
+	} else if !info.IsDir() {
+		return errorf(EXIT_USAGE, "%s is not a directory", dir)
+	}
+
+	// The project's doner.json, with its paths relative to the project
+	configPath := options.config
+	if configPath == "" {
+		configPath = filepath.Join(dir, DEFAULT_CONFIG_FILE)
+	}
+	config, err := LoadConfig(configPath)
+	if errors.Is(err, os.ErrNotExist) && options.config == "" {
+		config, err = &Config{}, nil
+	}
+	if err != nil {
+		return errorf(EXIT_IO, "loading config: %v", err)
+	}
+	config.resolvePaths(dir)
+	if config.IncludeRoot == "" {
+		config.IncludeRoot = dir
+	}
+
+	transpiler, config, code := options.configure(config)
+	if code != EXIT_OK {
+		return code
+	}
+	site := &Site{Dir: dir, Config: config.Site, Transpiler: transpiler, CheckLinks: *links}
+	if *output != "" {
+		if site.Config.Output, err = filepath.Abs(*output); err != nil {
+			return errorf(EXIT_IO, "%v", err)
+		}
+	}
+
+	report, err := site.Build()
+	if err != nil {
+		return errorf(EXIT_IO, "%v", err)
+	}
+	exitCode := printBuildReport(&report.BuildReport)
+	if report.Sitemap != "" {
+		fmt.Printf("Wrote %s for %d pages\n", filepath.Join(site.OutputDir(), report.Sitemap), len(report.SitePages))
+	} else {
+		fmt.Println("No sitemap.xml written: set site.url in doner.json")
+	}
+	return exitCode
+}
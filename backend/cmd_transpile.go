@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// transpileFlags are the flags that configure a transpiler, shared by the
+// commands that produce HTML
+type transpileFlags struct {
+	config     string
+	dictionary string
+	indent     int
+	mode       string
+	lang       string
+	data       string
+	variables  Variables
+	sourceMap  bool
+}
+
+func (f *transpileFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.config, "config", "", "config file (default doner.json)")
+	flags.StringVar(&f.dictionary, "dict", "", "JSON file with extra dictionary entries")
+	flags.IntVar(&f.indent, "indent", 2, "spaces per indentation level in pretty mode")
+	flags.StringVar(&f.mode, "mode", "default", "output layout: default, pretty or compact")
+	flags.StringVar(&f.lang, "lang", "", `set lang on <html> when missing, e.g. "de"`)
+	flags.StringVar(&f.data, "data", "", "JSON file with values for {{ name }} placeholders")
+	flags.BoolVar(&f.sourceMap, "source-map", false, "write a source map next to each HTML file (file.html.map)")
+	flags.Func("var", "set a placeholder value as name=value (repeatable)", func(assignment string) error {
+		name, value, err := ParseVariable(assignment)
+		if err != nil {
+			return err
+		}
+		f.variables = f.variables.Merge(Variables{name: value})
+		return nil
+	})
+}
+
+// newTranspiler builds a transpiler from the config file and the flags; the
+// returned exit code is EXIT_OK on success
+func (f *transpileFlags) newTranspiler() (*Transpiler, *Config, int) {
+	config, err := loadConfigFlag(f.config)
+	if err != nil {
+		return nil, nil, errorf(EXIT_IO, "loading config: %v", err)
+	}
+	return f.configure(config)
+}
+
+// configure builds a transpiler from an already loaded config and the flags
+func (f *transpileFlags) configure(config *Config) (*Transpiler, *Config, int) {
+	if f.dictionary != "" {
+		config.Dictionary = f.dictionary
+	}
+	if f.data != "" {
+		config.Data = f.data
+	}
+
+	mode, err := ParseOutputMode(f.mode)
+	if err != nil {
+		return nil, nil, errorf(EXIT_USAGE, "%v", err)
+	}
+	if f.indent < 0 {
+		return nil, nil, errorf(EXIT_USAGE, "--indent must not be negative")
+	}
+
+	transpiler, err := config.NewTranspiler()
+	if err != nil {
+		return nil, nil, errorf(EXIT_IO, "%v", err)
+	}
+	transpiler.SetOutput(mode, f.indent)
+	transpiler.AddVariables(f.variables)
+	if f.sourceMap {
+		transpiler.EnableSourceMaps()
+	}
+	if f.lang != "" {
+		transpiler.AddTransform(SetLanguage(f.lang))
+	}
+	return transpiler, config, EXIT_OK
+}
+
+// runTranspile implements "doner transpile [flags] <file>"
+func runTranspile(args []string) int {
+	flags := flag.NewFlagSet("transpile", flag.ContinueOnError)
+	var options transpileFlags
+	options.register(flags)
+	var output string
+	flags.StringVar(&output, "o", "", "write the HTML to this file instead of stdout")
+	flags.StringVar(&output, "output", "", "same as -o")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doner transpile [flags] [file.dhtml|-]")
+		fmt.Fprintln(flags.Output(), "Reads standard input when the file is - or missing; writes to standard output unless -o is given.")
+		flags.PrintDefaults()
+	}
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return EXIT_USAGE
+	}
+	if len(positional) > 1 {
+		flags.Usage()
+		return EXIT_USAGE
+	}
+	inputFile := "-"
+	if len(positional) == 1 {
+		inputFile = positional[0]
+	}
+
+	if options.sourceMap && (output == "" || output == "-") {
+		return errorf(EXIT_USAGE, "--source-map needs an output file (-o)")
+	}
+	transpiler, _, code := options.newTranspiler()
+	if code != EXIT_OK {
+		return code
+	}
+
+	// Read the German HTML file
+	content, err := readInput(inputFile)
+	if err != nil {
+		return errorf(EXIT_IO, "reading input: %v", err)
+	}
+
+	// Stream to stdout as the document is printed
+	if output == "" || output == "-" {
+		stdout := &trackingWriter{w: os.Stdout}
+		if _, err := transpiler.TranspileTo(stdout, inputName(inputFile), bytes.NewReader(content)); err != nil {
+			if stdout.err != nil {
+				return errorf(EXIT_IO, "writing output: %v", err)
+			}
+			return errorf(EXIT_PARSE, "%v", err)
+		}
+		return EXIT_OK
+	}
+
+	// Only touch the output file once the input transpiled cleanly
+	result, err := transpiler.TranspileSource(inputName(inputFile), string(content))
+	if err != nil {
+		return errorf(EXIT_PARSE, "%v", err)
+	}
+	if err := os.WriteFile(output, []byte(result.HTML), 0644); err != nil {
+		return errorf(EXIT_IO, "writing file: %v", err)
+	}
+	if result.SourceMap != nil {
+		if err := writeSourceMap(output, result.SourceMap); err != nil {
+			return errorf(EXIT_IO, "writing source map: %v", err)
+		}
+	}
+	return EXIT_OK
+}
+
+// runServe implements "doner serve [flags] [site-dir]"
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	flags.StringVar(&port, "port", port, "port to listen on (default $PORT or 8080)")
+	configPath := flags.String("config", "", "config file (default doner.json)")
+	dictionary := flags.String("dict", "", "JSON file with extra dictionary entries")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doner serve [flags] [site-dir]")
+		fmt.Fprintln(flags.Output(), "With a site directory, its sources are served as pages that reload on changes.")
+		flags.PrintDefaults()
+	}
+	paths, err := parseFlags(flags, args)
+	if err != nil {
+		return EXIT_USAGE
+	}
+	if len(paths) > 1 {
+		flags.Usage()
+		return EXIT_USAGE
+	}
+	siteDir := ""
+	if len(paths) == 1 {
+		siteDir = paths[0]
+		if info, err := os.Stat(siteDir); err != nil {
+			return errorf(EXIT_IO, "%v", err)
+		} else if !info.IsDir() {
+			return errorf(EXIT_USAGE, "%s is not a directory", siteDir)
+		}
+	}
+
+	config, err := loadConfigFlag(*configPath)
+	if err != nil {
+		return errorf(EXIT_IO, "loading config: %v", err)
+	}
+	if *dictionary != "" {
+		config.Dictionary = *dictionary
+	}
+
+	runServer(port, config, siteDir)
+	return EXIT_OK
+}
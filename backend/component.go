@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Component definitions:
+//
+//	<komponente name="karte" parameter="titel, farbe=grau">
+//	  <bereich klasse="karte karte-{{ farbe }}">
+//	    <überschrift2>{{ titel }}</überschrift2>
+//	    <platz />
+//	  </bereich>
+//	</komponente>
+//
+// and their use: <karte titel="Döner">Inhalt</karte>. Attributes become the
+// parameters, children go where the <platz /> is.
+const (
+	COMPONENT_TAG                 = "komponente"
+	COMPONENT_NAME_ATTRIBUTE      = "name"
+	COMPONENT_PARAMETER_ATTRIBUTE = "parameter"
+)
+
+// Component is a user-defined element
+type Component struct {
+	Name       string
+	Parameters []ComponentParameter
+	Body       []Node
+	Pos        Position // the <komponente> element
+}
+
+// ComponentParameter is a parameter of a component; parameters without a
+// default are required
+type ComponentParameter struct {
+	Name       string
+	Default    string
+	HasDefault bool
+}
+
+// parameter returns the parameter with the given name
+func (c *Component) parameter(name string) (ComponentParameter, bool) {
+	for _, parameter := range c.Parameters {
+		if parameter.Name == name {
+			return parameter, true
+		}
+	}
+	return ComponentParameter{}, false
+}
+
+// parameterNames lists the parameter names for error messages
+func (c *Component) parameterNames() string {
+	if len(c.Parameters) == 0 {
+		return "none"
+	}
+	names := make([]string, len(c.Parameters))
+	for i, parameter := range c.Parameters {
+		names[i] = parameter.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// LoadComponents reads component definitions from a file, which must hold
+// nothing but <komponente> elements, and makes them available to every
+// document this transpiler handles
+func (t *Transpiler) LoadComponents(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	document, _, err := t.parse(path, string(content))
+	if err != nil {
+		return err
+	}
+
+	components, err := t.collectComponents(document, t.components)
+	if err != nil {
+		return err
+	}
+	for _, node := range document.Children {
+		if !isBlankText(node) {
+			if _, ok := node.(*CommentNode); !ok {
+				return &SyntaxError{Pos: nodePosition(node), Message: fmt.Sprintf("component files may only contain <%s> elements", COMPONENT_TAG)}
+			}
+		}
+	}
+
+	if abs, err := filepath.Abs(path); err == nil {
+		t.componentFiles = append(t.componentFiles, abs)
+	}
+	t.components = components
+	return nil
+}
+
+// collectComponents removes the <komponente> definitions from a document and
+// returns them added to the given ones; definitions in the document override
+// inherited ones of the same name
+func (t *Transpiler) collectComponents(document *Document, inherited map[string]*Component) (map[string]*Component, error) {
+	components := make(map[string]*Component, len(inherited))
+	for name, component := range inherited {
+		components[name] = component
+	}
+	defined := map[string]bool{}
+
+	var failure error
+	Rewrite(document, func(node Node) Node {
+		element, ok := node.(*Element)
+		if !ok || failure != nil || element.SourceName != COMPONENT_TAG {
+			return node
+		}
+
+		component, err := t.defineComponent(element)
+		if err == nil && defined[component.Name] {
+			err = &SyntaxError{Pos: element.Pos, Message: fmt.Sprintf("component %q is defined twice", component.Name)}
+		}
+		if err != nil {
+			failure = err
+			return node
+		}
+		defined[component.Name] = true
+		components[component.Name] = component
+		return nil
+	})
+	return components, failure
+}
+
+// defineComponent turns a <komponente> element into a component
+func (t *Transpiler) defineComponent(element *Element) (*Component, error) {
+	name := strings.TrimSpace(sourceAttribute(element, COMPONENT_NAME_ATTRIBUTE))
+	if name == "" {
+		return nil, &SyntaxError{Pos: element.Pos, Message: fmt.Sprintf("<%s> needs a %s attribute", COMPONENT_TAG, COMPONENT_NAME_ATTRIBUTE)}
+	}
+	if isDirective(name) {
+		return nil, &SyntaxError{Pos: element.Pos, Message: fmt.Sprintf("component name %q is reserved", name)}
+	}
+	if _, kind := t.dictionary.LookupTag(name); kind != NAME_UNKNOWN {
+		return nil, &SyntaxError{Pos: element.Pos, Message: fmt.Sprintf("component name %q is already an element", name)}
+	}
+
+	component := &Component{Name: name, Body: element.Children, Pos: element.Pos}
+	for _, field := range strings.Split(sourceAttribute(element, COMPONENT_PARAMETER_ATTRIBUTE), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		parameterName, value, hasDefault := strings.Cut(field, "=")
+		parameter := ComponentParameter{Name: strings.TrimSpace(parameterName), Default: strings.TrimSpace(value), HasDefault: hasDefault}
+		if _, exists := component.parameter(parameter.Name); exists || parameter.Name == "" {
+			return nil, &SyntaxError{Pos: element.Pos, Message: fmt.Sprintf("invalid parameter %q in component %q", field, name)}
+		}
+		component.Parameters = append(component.Parameters, parameter)
+	}
+	return component, nil
+}
+
+// directiveTags are the tags the transpiler handles itself, and <markdown>
+// which the parser converts; editors complete and highlight them
+var directiveTags = []string{INCLUDE_TAG, LAYOUT_TAG, SLOT_TAG, FILL_TAG, IF_TAG, ELSE_TAG, EACH_TAG, COMPONENT_TAG, MARKDOWN_TAG}
+
+// isDirective reports whether a tag name is one the transpiler handles itself
+func isDirective(name string) bool {
+	switch name {
+	case INCLUDE_TAG, LAYOUT_TAG, SLOT_TAG, FILL_TAG, IF_TAG, ELSE_TAG, EACH_TAG, COMPONENT_TAG:
+		return true
+	}
+	return false
+}
+
+// evaluateComponent expands a use of a component: the attributes, with their
+// placeholders filled in, become parameters and the already evaluated
+// children fill the component's <platz />
+func evaluateComponent(use *Element, component *Component, scope Variables, ctx *templateContext) ([]Node, error) {
+	if ctx.depth >= MAX_INCLUDE_DEPTH {
+		return nil, &SyntaxError{Pos: use.Pos, Message: fmt.Sprintf("components nested more than %d levels deep (is <%s> recursive?)", MAX_INCLUDE_DEPTH, component.Name)}
+	}
+
+	parameters := Variables{}
+	for _, attr := range use.Attributes {
+		if _, exists := component.parameter(attr.SourceName); !exists {
+			return nil, &SyntaxError{Pos: attr.Pos, Message: fmt.Sprintf("component <%s> has no parameter %q (parameters: %s)", component.Name, attr.SourceName, component.parameterNames())}
+		}
+		value, err := interpolate(attr.Value, scope, attr.valuePosition())
+		if err != nil {
+			return nil, err
+		}
+		// Attribute values are HTML, parameters are text that is escaped again when inserted
+		parameters[attr.SourceName] = html.UnescapeString(value)
+	}
+	var missing []string
+	for _, parameter := range component.Parameters {
+		if _, given := parameters[parameter.Name]; given {
+			continue
+		}
+		if !parameter.HasDefault {
+			missing = append(missing, parameter.Name)
+			continue
+		}
+		parameters[parameter.Name] = parameter.Default
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, &SyntaxError{Pos: use.Pos, Message: fmt.Sprintf("component <%s> is missing %s", component.Name, strings.Join(missing, ", "))}
+	}
+
+	children, err := evaluateNodes(use.Children, scope, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inner := &templateContext{components: ctx.components, depth: ctx.depth + 1, component: component, slot: children}
+	body, err := evaluateNodes(component.Body, scope.Merge(parameters), inner)
+	if err != nil {
+		return nil, err
+	}
+	if hasContent(children) && !inner.slotUsed {
+		return nil, &SyntaxError{Pos: use.Pos, Message: fmt.Sprintf("component <%s> has no <%s /> for its content", component.Name, SLOT_TAG)}
+	}
+	return body, nil
+}
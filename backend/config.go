@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DEFAULT_CONFIG_FILE is read from the working directory when DONER_CONFIG is not set
+const DEFAULT_CONFIG_FILE = "doner.json"
+
+// Config holds project settings shared by the CLI and the server
+type Config struct {
+	// Passes lists registered pipeline passes to enable, by name
+	Passes []string `json:"passes"`
+
+	// Lint enables or disables lint rules
+	Lint LintConfig `json:"lint"`
+
+	// Dictionary is a JSON file with extra tag and attribute mappings
+	Dictionary string `json:"dictionary,omitempty"`
+
+	// IncludeRoot is the directory includes must stay in. The server only
+	// resolves includes when it is set.
+	IncludeRoot string `json:"includeRoot,omitempty"`
+
+	// Data is a JSON file with values for {{ name }} placeholders
+	Data string `json:"data,omitempty"`
+
+	// Components lists files, or glob patterns, with <komponente> definitions
+	// available to every page
+	Components []string `json:"components,omitempty"`
+
+	// Site configures "doner site"
+	Site SiteConfig `json:"site"`
+
+	path string // the file the config was read from, empty for the defaults
+}
+
+// LoadConfig reads a JSON config file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	config.path = path
+	return &config, nil
+}
+
+// loadDefaultConfig reads the file named by DONER_CONFIG, or doner.json if it
+// exists, and falls back to an empty config otherwise
+func loadDefaultConfig() (*Config, error) {
+	if path := os.Getenv("DONER_CONFIG"); path != "" {
+		return LoadConfig(path)
+	}
+
+	config, err := LoadConfig(DEFAULT_CONFIG_FILE)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	return config, err
+}
+
+// resolvePaths makes the relative paths in the config relative to dir, for
+// a project config read from another directory
+func (c *Config) resolvePaths(dir string) {
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	c.Dictionary = resolve(c.Dictionary)
+	c.IncludeRoot = resolve(c.IncludeRoot)
+	c.Data = resolve(c.Data)
+	for i, pattern := range c.Components {
+		c.Components[i] = resolve(pattern)
+	}
+}
+
+// LoadDictionary returns the built-in dictionary extended by the configured
+// dictionary file, if any
+func (c *Config) LoadDictionary() (*Dictionary, error) {
+	if c.Dictionary == "" {
+		return NewDictionary(), nil
+	}
+	return LoadDictionaryFile(c.Dictionary)
+}
+
+// NewTranspiler creates a transpiler with the configured passes enabled
+func (c *Config) NewTranspiler() (*Transpiler, error) {
+	transpiler := NewTranspiler()
+	transpiler.addConfigFile(c.path)
+	dictionary, err := c.LoadDictionary()
+	if err != nil {
+		return nil, err
+	}
+	transpiler.SetDictionary(dictionary)
+	transpiler.addConfigFile(c.Dictionary)
+	if c.Data != "" {
+		variables, err := LoadVariablesFile(c.Data)
+		if err != nil {
+			return nil, err
+		}
+		transpiler.AddData(variables)
+		transpiler.addConfigFile(c.Data)
+	}
+	for _, pattern := range c.Components {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("invalid config: no component files match %s", pattern)
+		}
+		for _, file := range files {
+			if err := transpiler.LoadComponents(file); err != nil {
+				return nil, err
+			}
+		}
+	}
+	transpiler.SetIncludeRoot(c.IncludeRoot)
+	if err := transpiler.EnablePasses(c.Passes...); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return transpiler, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Control elements, evaluated at transpile time:
+//
+//	<wenn bedingung="angemeldet">…</wenn><sonst>…</sonst>
+//	<für-jedes element="artikel" in="artikel_liste">…</für-jedes>
+const (
+	IF_TAG            = "wenn"
+	IF_ATTRIBUTE      = "bedingung"
+	ELSE_TAG          = "sonst"
+	EACH_TAG          = "für-jedes"
+	EACH_ATTRIBUTE    = "element"
+	EACH_IN_ATTRIBUTE = "in"
+)
+
+// templateContext is what evaluation needs besides the variables in scope
+type templateContext struct {
+	components map[string]*Component
+	depth      int // components being expanded
+
+	// Inside a component body: the caller's children for its <platz />
+	component *Component
+	slot      []Node
+	slotUsed  bool
+}
+
+// evaluateTemplate runs the control elements and components of a document and
+// fills in its {{ name }} placeholders. Loops bring their element into scope
+// for their body, components their parameters.
+func evaluateTemplate(document *Document, variables Variables, components map[string]*Component) error {
+	ctx := &templateContext{components: components}
+	children, err := evaluateNodes(document.Children, variables, ctx)
+	if err != nil {
+		return err
+	}
+	document.Children = children
+	return nil
+}
+
+// evaluateNodes evaluates a list of sibling nodes into fresh nodes, so loop
+// bodies can be evaluated once per item. Text the lexer cut into chunks is
+// joined first, so a placeholder across a cut is still found.
+func evaluateNodes(nodes []Node, scope Variables, ctx *templateContext) ([]Node, error) {
+	nodes = mergeText(nodes)
+	var result []Node
+	for i := 0; i < len(nodes); i++ {
+		switch n := nodes[i].(type) {
+		case *TextNode:
+			content, err := interpolate(n.Content, scope, n.Pos)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, &TextNode{Content: content, Pos: n.Pos})
+
+		case *Element:
+			switch n.SourceName {
+			case IF_TAG:
+				// A <sonst> directly after the <wenn>, ignoring blank text, belongs to it
+				otherwise := -1
+				for j := i + 1; j < len(nodes); j++ {
+					if isBlankText(nodes[j]) {
+						continue
+					}
+					if next, ok := nodes[j].(*Element); ok && next.SourceName == ELSE_TAG {
+						otherwise = j
+					}
+					break
+				}
+
+				branch, err := evaluateCondition(n, scope)
+				if err != nil {
+					return nil, err
+				}
+				body := n.Children
+				if !branch {
+					body = nil
+					if otherwise >= 0 {
+						body = nodes[otherwise].(*Element).Children
+					}
+				}
+				evaluated, err := evaluateNodes(body, scope, ctx)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, evaluated...)
+				if otherwise >= 0 {
+					i = otherwise
+				}
+
+			case ELSE_TAG:
+				return nil, &SyntaxError{Pos: n.Pos, Message: fmt.Sprintf("<%s> without a preceding <%s>", ELSE_TAG, IF_TAG)}
+
+			case EACH_TAG:
+				evaluated, err := evaluateLoop(n, scope, ctx)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, evaluated...)
+
+			case SLOT_TAG:
+				if ctx.component == nil {
+					element, err := evaluateElement(n, scope, ctx)
+					if err != nil {
+						return nil, err
+					}
+					result = append(result, element)
+					break
+				}
+				// The caller's content, or the slot's own content when there is none
+				ctx.slotUsed = true
+				if hasContent(ctx.slot) {
+					result = append(result, ctx.slot...)
+					break
+				}
+				evaluated, err := evaluateNodes(n.Children, scope, ctx)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, evaluated...)
+
+			default:
+				if component, ok := ctx.components[n.SourceName]; ok {
+					evaluated, err := evaluateComponent(n, component, scope, ctx)
+					if err != nil {
+						return nil, err
+					}
+					result = append(result, evaluated...)
+					break
+				}
+				element, err := evaluateElement(n, scope, ctx)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, element)
+			}
+
+		default:
+			result = append(result, n)
+		}
+	}
+	return result, nil
+}
+
+// evaluateElement copies an element with its attribute values interpolated
+// and its children evaluated
+func evaluateElement(e *Element, scope Variables, ctx *templateContext) (*Element, error) {
+	copied := *e
+	copied.Attributes = make([]*Attribute, len(e.Attributes))
+	for i, attr := range e.Attributes {
+		value, err := interpolate(attr.Value, scope, attr.valuePosition())
+		if err != nil {
+			return nil, err
+		}
+		a := *attr
+		a.Value = value
+		copied.Attributes[i] = &a
+	}
+
+	children, err := evaluateNodes(e.Children, scope, ctx)
+	if err != nil {
+		return nil, err
+	}
+	copied.Children = children
+	return &copied, nil
+}
+
+// evaluateCondition evaluates the bedingung of a <wenn> element
+func evaluateCondition(e *Element, scope Variables) (bool, error) {
+	attr := findSourceAttribute(e, IF_ATTRIBUTE)
+	if attr == nil || strings.TrimSpace(attr.Value) == "" {
+		return false, &SyntaxError{Pos: e.Pos, Message: fmt.Sprintf("<%s> needs a %s attribute", IF_TAG, IF_ATTRIBUTE)}
+	}
+
+	condition, err := parseExpression(attr.Value)
+	if err != nil {
+		return false, &SyntaxError{Pos: attr.Pos, Message: fmt.Sprintf("invalid %s: %v", IF_ATTRIBUTE, err)}
+	}
+	value, err := condition.eval(scope)
+	if err != nil {
+		return false, &SyntaxError{Pos: attr.Pos, Message: fmt.Sprintf("%s %q: %v", IF_ATTRIBUTE, attr.Value, err)}
+	}
+	return truthy(value), nil
+}
+
+// evaluateLoop evaluates the body of a <für-jedes> element once per item of
+// its list, with the item bound to the element name
+func evaluateLoop(e *Element, scope Variables, ctx *templateContext) ([]Node, error) {
+	name := sourceAttribute(e, EACH_ATTRIBUTE)
+	listName := sourceAttribute(e, EACH_IN_ATTRIBUTE)
+	if name == "" || listName == "" {
+		return nil, &SyntaxError{Pos: e.Pos, Message: fmt.Sprintf("<%s> needs %s and %s attributes", EACH_TAG, EACH_ATTRIBUTE, EACH_IN_ATTRIBUTE)}
+	}
+
+	value, found := scope.Lookup(listName)
+	if !found {
+		return nil, &SyntaxError{Pos: e.Pos, Message: fmt.Sprintf("undefined variable %q", listName)}
+	}
+	var items []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		items = v
+	case nil:
+		// nothing to repeat
+	default:
+		return nil, &SyntaxError{Pos: e.Pos, Message: fmt.Sprintf("%q must be a list, got %s", listName, describeValue(value))}
+	}
+
+	var result []Node
+	for _, item := range items {
+		evaluated, err := evaluateNodes(e.Children, scope.Merge(Variables{name: item}), ctx)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, evaluated...)
+	}
+	return result, nil
+}
+
+// isBlankText reports whether a node is whitespace-only text
+func isBlankText(node Node) bool {
+	text, ok := node.(*TextNode)
+	return ok && strings.TrimSpace(text.Content) == ""
+}
+
+// hasContent reports whether nodes hold anything but blank text
+func hasContent(nodes []Node) bool {
+	for _, node := range nodes {
+		if !isBlankText(node) {
+			return true
+		}
+	}
+	return false
+}
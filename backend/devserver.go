@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LIVE_RELOAD_PATH is the server-sent events endpoint pages served by the
+// dev server listen on
+const LIVE_RELOAD_PATH = "/__doner/livereload"
+
+// liveReloadSnippet is injected into every page served by the dev server
+const liveReloadSnippet = `<script>new EventSource("` + LIVE_RELOAD_PATH + `").addEventListener("reload", function () { location.reload(); });</script>`
+
+// cachedPage is a transpiled page together with the stamps of every file it
+// was built from
+type cachedPage struct {
+	stamps map[string]fileStamp // absolute path → stamp
+	html   []byte
+}
+
+// fresh reports whether none of the files the page was built from changed
+func (c *cachedPage) fresh() bool {
+	for path, stamp := range c.stamps {
+		info, err := os.Stat(path)
+		if err != nil || (fileStamp{modTime: info.ModTime(), size: info.Size()}) != stamp {
+			return false
+		}
+	}
+	return true
+}
+
+// siteServer serves a directory of German HTML sources, transpiling them on
+// request, and tells open pages to reload when a file changes
+type siteServer struct {
+	dir        string
+	transpiler *Transpiler
+	files      http.Handler
+
+	mutex sync.Mutex
+	cache map[string]*cachedPage // absolute source path → page
+
+	reload *reloadBroadcaster
+}
+
+func newSiteServer(dir string, transpiler *Transpiler) *siteServer {
+	return &siteServer{
+		dir:        dir,
+		transpiler: transpiler,
+		files:      http.FileServer(http.Dir(dir)),
+		cache:      make(map[string]*cachedPage),
+		reload:     newReloadBroadcaster(),
+	}
+}
+
+// ServeHTTP serves the page for a source file when the URL maps to one and
+// falls back to the plain file otherwise
+func (s *siteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	source := s.sourceFor(r.URL.Path)
+	if source == "" {
+		s.files.ServeHTTP(w, r)
+		return
+	}
+
+	page, err := s.page(source)
+	if err != nil {
+		log.Printf("%v", err)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "<!DOCTYPE html>\n<title>Fehler</title>\n<pre>%s</pre>\n%s\n", html.EscapeString(err.Error()), liveReloadSnippet)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(injectLiveReload(page))
+}
+
+// sourceFor maps a URL path to the source file that renders it: "/" and
+// directories to their index, "/seite.html" and "/seite" to seite.dhtml or
+// seite.doner, and source paths to themselves. It returns "" when no source
+// file matches.
+func (s *siteServer) sourceFor(urlPath string) string {
+	clean := path.Clean("/" + urlPath)
+	var bases []string
+	switch {
+	case strings.HasSuffix(urlPath, "/"):
+		bases = []string{path.Join(clean, "index")}
+	case isSourceFile(clean):
+		return s.existing(clean)
+	case strings.HasSuffix(clean, ".html"):
+		bases = []string{strings.TrimSuffix(clean, ".html")}
+	case path.Ext(clean) == "":
+		bases = []string{clean, path.Join(clean, "index")}
+	}
+
+	for _, base := range bases {
+		for _, ext := range sourceExtensions {
+			if source := s.existing(base + ext); source != "" {
+				return source
+			}
+		}
+	}
+	return ""
+}
+
+// existing returns the file system path of a URL path when it names a regular
+// file inside the site directory
+func (s *siteServer) existing(urlPath string) string {
+	file := filepath.Join(s.dir, filepath.FromSlash(urlPath))
+	if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	return file
+}
+
+// page returns the transpiled source, from the cache while neither the source
+// nor anything it read has changed
+func (s *siteServer) page(source string) ([]byte, error) {
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	cached := s.cache[abs]
+	s.mutex.Unlock()
+	if cached != nil && cached.fresh() {
+		return cached.html, nil
+	}
+
+	// Stamp before reading so a change during transpiling invalidates the entry
+	stamps := map[string]fileStamp{}
+	stamp := func(path string) {
+		if info, err := os.Stat(path); err == nil {
+			stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	stamp(abs)
+
+	content, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.transpiler.TranspileSource(source, string(content))
+	if err != nil {
+		return nil, err
+	}
+	for _, dep := range result.Dependencies {
+		stamp(dep)
+	}
+
+	page := &cachedPage{stamps: stamps, html: []byte(result.HTML)}
+	s.mutex.Lock()
+	s.cache[abs] = page
+	s.mutex.Unlock()
+	return page.html, nil
+}
+
+// watch polls the site directory and broadcasts a reload whenever a file is
+// added, changed or removed, until stop is closed
+func (s *siteServer) watch(interval time.Duration, stop <-chan struct{}) {
+	list := func() snapshot {
+		files, err := listFiles(s.dir, "")
+		if err != nil {
+			return nil
+		}
+		return takeSnapshot(s.dir, files)
+	}
+
+	current := list()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		next := list()
+		if next == nil {
+			continue
+		}
+		changed, removed := diffSnapshots(current, next)
+		current = next
+		if len(changed) > 0 || len(removed) > 0 {
+			log.Printf("changed: %s", strings.Join(append(changed, removed...), ", "))
+			s.reload.broadcast()
+		}
+	}
+}
+
+// serveLiveReload streams a "reload" event to the page whenever the site changes
+func (s *siteServer) serveLiveReload(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	events := s.reload.subscribe()
+	defer s.reload.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-events:
+			fmt.Fprint(w, "event: reload\ndata: {}\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// injectLiveReload inserts the live-reload snippet before </body>, or appends
+// it when the page has no body end tag
+func injectLiveReload(page []byte) []byte {
+	snippet := []byte(liveReloadSnippet + "\n")
+	i := bytes.LastIndex(bytes.ToLower(page), []byte("</body>"))
+	if i < 0 {
+		return append(append([]byte{}, page...), snippet...)
+	}
+	out := make([]byte, 0, len(page)+len(snippet))
+	out = append(out, page[:i]...)
+	out = append(out, snippet...)
+	return append(out, page[i:]...)
+}
+
+// reloadBroadcaster fans reload notifications out to the connected pages
+type reloadBroadcaster struct {
+	mutex       sync.Mutex
+	subscribers map[chan struct{}]bool
+}
+
+func newReloadBroadcaster() *reloadBroadcaster {
+	return &reloadBroadcaster{subscribers: make(map[chan struct{}]bool)}
+}
+
+func (b *reloadBroadcaster) subscribe() chan struct{} {
+	// Buffered so a notification is kept while the handler is busy writing
+	ch := make(chan struct{}, 1)
+	b.mutex.Lock()
+	b.subscribers[ch] = true
+	b.mutex.Unlock()
+	return ch
+}
+
+func (b *reloadBroadcaster) unsubscribe(ch chan struct{}) {
+	b.mutex.Lock()
+	delete(b.subscribers, ch)
+	b.mutex.Unlock()
+}
+
+func (b *reloadBroadcaster) broadcast() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
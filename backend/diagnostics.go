@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Position is a location in a German HTML source
+type Position struct {
+	File   string `json:"file,omitempty"`
+	Offset int    `json:"offset"` // rune offset
+	Line   int    `json:"line"`   // 1-based
+	Column int    `json:"column"` // 1-based, in runes
+}
+
+// IsValid reports whether the position points into a source
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns "file:line:column", leaving out what is unknown
+func (p Position) String() string {
+	switch {
+	case !p.IsValid() && p.File == "":
+		return ""
+	case !p.IsValid():
+		return p.File
+	case p.File == "":
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	default:
+		return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+	}
+}
+
+// tokenPosition returns the position of a token in the named file
+func tokenPosition(file string, tok Token) Position {
+	return Position{File: file, Offset: tok.Position, Line: tok.Line, Column: tok.Column}
+}
+
+// Severity ranks diagnostics
+type Severity int
+
+const (
+	SEVERITY_ERROR Severity = iota
+	SEVERITY_WARNING
+	SEVERITY_INFO
+)
+
+// String returns a string representation of the severity
+func (s Severity) String() string {
+	switch s {
+	case SEVERITY_ERROR:
+		return "error"
+	case SEVERITY_WARNING:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// MarshalJSON encodes the severity by name
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Diagnostic is a problem found in a source, by the parser or by a check
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Pos      Position `json:"position"`
+}
+
+// String returns "file:line:column: severity: message (code)"
+func (d Diagnostic) String() string {
+	prefix := ""
+	if pos := d.Pos.String(); pos != "" {
+		prefix = pos + ": "
+	}
+	return fmt.Sprintf("%s%s: %s (%s)", prefix, d.Severity, d.Message, d.Code)
+}
+
+// SyntaxError is a parse error at a known position
+type SyntaxError struct {
+	Pos     Position
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	if pos := e.Pos.String(); pos != "" {
+		return pos + ": " + e.Message
+	}
+	return e.Message
+}
+
+// DiagnosticFromError turns an error into an error diagnostic, keeping the
+// position of syntax errors
+func DiagnosticFromError(err error) Diagnostic {
+	// An include error points at the directive; its message carries the
+	// position inside the included file
+	var includeErr *IncludeError
+	if errors.As(err, &includeErr) {
+		message := fmt.Sprintf("%s: %v", includeErr.action(), includeErr.Err)
+		return Diagnostic{Severity: SEVERITY_ERROR, Code: "include", Message: message, Pos: includeErr.Pos}
+	}
+	var syntaxErr *SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return Diagnostic{Severity: SEVERITY_ERROR, Code: "syntax", Message: syntaxErr.Message, Pos: syntaxErr.Pos}
+	}
+	return Diagnostic{Severity: SEVERITY_ERROR, Code: "error", Message: err.Error()}
+}
+
+// sortDiagnostics orders diagnostics by file and position
+func sortDiagnostics(diagnostics []Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Pos, diagnostics[j].Pos
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Offset < b.Offset
+	})
+}
+
+// Check inspects a document and reports problems without changing it
+type Check func(doc *Document) []Diagnostic
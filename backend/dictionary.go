@@ -1,5 +1,12 @@
 package main
 
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
 // Dictionary contains the German to HTML translations
 type Dictionary struct {
 	tags       map[string]string
@@ -36,6 +43,7 @@ func NewDictionary() *Dictionary {
 			"absatz":            "p",       // paragraph
 			"p":                 "p",       // allow English too
 			"bereich":           "div",     // div
+			"abschnitt":         "section", // section
 			"spanne":            "span",    // span
 			"stark":             "strong",  // strong
 			"betont":            "em",      // emphasized
@@ -108,6 +116,36 @@ func NewDictionary() *Dictionary {
 	}
 }
 
+// dictionaryFile is the JSON shape of a dictionary extension file, the same
+// shape the /dictionary endpoint returns
+type dictionaryFile struct {
+	Tags       map[string]string `json:"tags"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// LoadDictionaryFile returns the built-in dictionary extended with the
+// mappings in a JSON file; entries in the file override built-in ones
+func LoadDictionaryFile(path string) (*Dictionary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var extension dictionaryFile
+	if err := json.Unmarshal(data, &extension); err != nil {
+		return nil, fmt.Errorf("invalid dictionary %s: %w", path, err)
+	}
+
+	dictionary := NewDictionary()
+	for german, html := range extension.Tags {
+		dictionary.tags[german] = html
+	}
+	for german, html := range extension.Attributes {
+		dictionary.attributes[german] = html
+	}
+	return dictionary, nil
+}
+
 // TranslateTag translates a German tag to HTML
 func (d *Dictionary) TranslateTag(germanTag string) (string, bool) {
 	htmlTag, exists := d.tags[germanTag]
@@ -119,3 +157,84 @@ func (d *Dictionary) TranslateAttribute(germanAttr string) (string, bool) {
 	htmlAttr, exists := d.attributes[germanAttr]
 	return htmlAttr, exists
 }
+
+// LookupTag resolves a source tag name to its HTML name and reports how it was resolved
+func (d *Dictionary) LookupTag(name string) (string, NameKind) {
+	if htmlTag, exists := d.tags[name]; exists {
+		if htmlTag == name {
+			return htmlTag, NAME_PASSTHROUGH
+		}
+		return htmlTag, NAME_TRANSLATED
+	}
+	if htmlElements[name] {
+		return name, NAME_PASSTHROUGH
+	}
+	return name, NAME_UNKNOWN // Keep original if no translation exists
+}
+
+// LookupAttribute resolves a source attribute name to its HTML name and reports how it was resolved
+func (d *Dictionary) LookupAttribute(name string) (string, NameKind) {
+	if htmlAttr, exists := d.attributes[name]; exists {
+		if htmlAttr == name {
+			return htmlAttr, NAME_PASSTHROUGH
+		}
+		return htmlAttr, NAME_TRANSLATED
+	}
+	if htmlAttributes[name] || strings.HasPrefix(name, "data-") || strings.HasPrefix(name, "aria-") {
+		return name, NAME_PASSTHROUGH
+	}
+	return name, NAME_UNKNOWN // Keep original if no translation exists
+}
+
+// GermanTag returns a German name that translates to the given HTML tag,
+// preferring the alphabetically first when there are several
+func (d *Dictionary) GermanTag(htmlTag string) (string, bool) {
+	return reverseLookup(d.tags, htmlTag)
+}
+
+// GermanAttribute returns a German name that translates to the given HTML attribute
+func (d *Dictionary) GermanAttribute(htmlAttr string) (string, bool) {
+	return reverseLookup(d.attributes, htmlAttr)
+}
+
+func reverseLookup(mappings map[string]string, html string) (string, bool) {
+	best := ""
+	for german, target := range mappings {
+		if target == html && german != html && (best == "" || german < best) {
+			best = german
+		}
+	}
+	return best, best != ""
+}
+
+// htmlElements lists standard HTML element names that pass through untranslated
+var htmlElements = toSet(
+	"a", "abbr", "address", "area", "article", "aside", "audio", "b", "base", "bdi", "bdo",
+	"blockquote", "body", "br", "button", "canvas", "caption", "cite", "code", "col", "colgroup",
+	"data", "datalist", "dd", "del", "details", "dfn", "dialog", "div", "dl", "dt", "em", "embed",
+	"fieldset", "figcaption", "figure", "footer", "form", "h1", "h2", "h3", "h4", "h5", "h6",
+	"head", "header", "hgroup", "hr", "html", "i", "iframe", "img", "input", "ins", "kbd", "label",
+	"legend", "li", "link", "main", "map", "mark", "menu", "meta", "meter", "nav", "noscript",
+	"object", "ol", "optgroup", "option", "output", "p", "picture", "pre", "progress", "q", "rp",
+	"rt", "ruby", "s", "samp", "script", "search", "section", "select", "slot", "small", "source",
+	"span", "strong", "style", "sub", "summary", "sup", "table", "tbody", "td", "template",
+	"textarea", "tfoot", "th", "thead", "time", "title", "tr", "track", "u", "ul", "var", "video", "wbr",
+)
+
+// htmlAttributes lists common HTML attribute names that pass through untranslated
+var htmlAttributes = toSet(
+	"accept", "action", "alt", "autocomplete", "autofocus", "charset", "checked", "class", "cols",
+	"colspan", "content", "controls", "datetime", "dir", "disabled", "download", "for", "form",
+	"height", "hidden", "href", "hreflang", "id", "lang", "loading", "max", "maxlength", "media",
+	"method", "min", "minlength", "multiple", "name", "pattern", "placeholder", "readonly", "rel",
+	"required", "role", "rows", "rowspan", "scope", "selected", "size", "span", "src", "srcset",
+	"step", "style", "tabindex", "target", "title", "type", "value", "width",
+)
+
+func toSet(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expressions are the conditions of <wenn bedingung="...">. They are
+// deliberately small: variables (with dots for nested values), string,
+// number and boolean literals, comparisons, and the logical operators
+// und, oder and nicht (or &&, || and !), with parentheses for grouping.
+// Nothing can call functions or change data.
+//
+//	angemeldet
+//	nicht warenkorb.leer
+//	anzahl >= 3 und sprache == "de"
+
+// expression is a parsed condition
+type expression interface {
+	eval(scope Variables) (interface{}, error)
+}
+
+type literalExpression struct{ value interface{} }
+
+type variableExpression struct{ name string }
+
+type notExpression struct{ operand expression }
+
+type binaryExpression struct {
+	operator    string
+	left, right expression
+}
+
+func (e *literalExpression) eval(scope Variables) (interface{}, error) {
+	return e.value, nil
+}
+
+func (e *variableExpression) eval(scope Variables) (interface{}, error) {
+	value, found := scope.Lookup(e.name)
+	if !found {
+		return nil, fmt.Errorf("undefined variable %q", e.name)
+	}
+	return value, nil
+}
+
+func (e *notExpression) eval(scope Variables) (interface{}, error) {
+	value, err := e.operand.eval(scope)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(value), nil
+}
+
+func (e *binaryExpression) eval(scope Variables) (interface{}, error) {
+	left, err := e.left.eval(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// und/oder short-circuit, so "angemeldet und benutzer.name" works when
+	// benutzer is only defined for logged-in visitors
+	switch e.operator {
+	case "und":
+		if !truthy(left) {
+			return false, nil
+		}
+		right, err := e.right.eval(scope)
+		return err == nil && truthy(right), err
+	case "oder":
+		if truthy(left) {
+			return true, nil
+		}
+		right, err := e.right.eval(scope)
+		return err == nil && truthy(right), err
+	}
+
+	right, err := e.right.eval(scope)
+	if err != nil {
+		return nil, err
+	}
+	return compareValues(e.operator, left, right)
+}
+
+// truthy reports whether a value counts as true: false, 0, "", null and
+// empty lists and objects are false, everything else is true
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case int:
+		return v != 0
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	default:
+		return true
+	}
+}
+
+// compareValues applies a comparison operator. Numbers compare numerically;
+// a string compared with a number is read as a number, since --var values
+// are always strings.
+func compareValues(operator string, left, right interface{}) (bool, error) {
+	if l, r, ok := numbers(left, right); ok {
+		switch operator {
+		case "==":
+			return l == r, nil
+		case "!=":
+			return l != r, nil
+		case "<":
+			return l < r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		case ">=":
+			return l >= r, nil
+		}
+	}
+
+	l, lok := left.(string)
+	r, rok := right.(string)
+	switch operator {
+	case "==":
+		return equalValues(left, right), nil
+	case "!=":
+		return !equalValues(left, right), nil
+	}
+	if !lok || !rok {
+		return false, fmt.Errorf("cannot compare %s %s %s", describeValue(left), operator, describeValue(right))
+	}
+	switch operator {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	default:
+		return l >= r, nil
+	}
+}
+
+// equalValues compares values that are not both numbers. Lists and objects
+// are never equal to anything.
+func equalValues(left, right interface{}) bool {
+	switch l := left.(type) {
+	case nil:
+		return right == nil
+	case bool:
+		r, ok := right.(bool)
+		return ok && l == r
+	case string:
+		r, ok := right.(string)
+		return ok && l == r
+	}
+	return false
+}
+
+// numbers returns both values as numbers when at least one is a number and
+// the other is a number or numeric text
+func numbers(left, right interface{}) (float64, float64, bool) {
+	l, lnum := toNumber(left)
+	r, rnum := toNumber(right)
+	_, lstr := left.(string)
+	_, rstr := right.(string)
+	if lstr && rstr {
+		return 0, 0, false
+	}
+	return l, r, lnum && rnum
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// describeValue names the type of a value for error messages
+func describeValue(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, int:
+		return "number"
+	case string:
+		return "text"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// parseExpression parses a condition
+func parseExpression(source string) (expression, error) {
+	tokens, err := scanExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &expressionParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != exprEOF {
+		return nil, fmt.Errorf("unexpected %s at column %d", tok, tok.column)
+	}
+	return expr, nil
+}
+
+// Expression token kinds
+const (
+	exprEOF = iota
+	exprName
+	exprNumber
+	exprString
+	exprOperator
+	exprLeftParen
+	exprRightParen
+)
+
+type exprToken struct {
+	kind   int
+	text   string
+	column int // 1-based, in runes
+}
+
+func (t exprToken) String() string {
+	if t.kind == exprEOF {
+		return "end of condition"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// scanExpression splits a condition into tokens
+func scanExpression(source string) ([]exprToken, error) {
+	runes := []rune(source)
+	var tokens []exprToken
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, exprToken{exprLeftParen, "(", start + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, exprToken{exprRightParen, ")", start + 1})
+			i++
+		case r == '"' || r == '\'':
+			i++
+			for i < len(runes) && runes[i] != r {
+				i++
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated string at column %d", start+1)
+			}
+			i++
+			tokens = append(tokens, exprToken{exprString, string(runes[start+1 : i-1]), start + 1})
+		case unicode.IsDigit(r):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, exprToken{exprNumber, string(runes[start:i]), start + 1})
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || strings.ContainsRune("_-.", runes[i])) {
+				i++
+			}
+			tokens = append(tokens, exprToken{exprName, string(runes[start:i]), start + 1})
+		default:
+			operator := ""
+			for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!"} {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					operator = op
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected %q at column %d", r, start+1)
+			}
+			i += len([]rune(operator))
+			tokens = append(tokens, exprToken{exprOperator, operator, start + 1})
+		}
+	}
+	return append(tokens, exprToken{exprEOF, "", len(runes) + 1}), nil
+}
+
+// expressionParser is a recursive descent parser over the scanned tokens
+type expressionParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *expressionParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *expressionParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != exprEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// keyword reports whether the next token is one of the given word or symbol
+// operators, and consumes it if so
+func (p *expressionParser) keyword(word, symbol string) bool {
+	tok := p.peek()
+	if (tok.kind == exprName && tok.text == word) || (tok.kind == exprOperator && tok.text == symbol) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *expressionParser) parseOr() (expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("oder", "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpression{operator: "oder", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseAnd() (expression, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("und", "&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpression{operator: "und", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseNot() (expression, error) {
+	if p.keyword("nicht", "!") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpression{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *expressionParser) parseComparison() (expression, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	if tok.kind != exprOperator || tok.text == "!" || tok.text == "&&" || tok.text == "||" {
+		return left, nil
+	}
+	p.pos++
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryExpression{operator: tok.text, left: left, right: right}, nil
+}
+
+func (p *expressionParser) parsePrimary() (expression, error) {
+	tok := p.next()
+	switch tok.kind {
+	case exprLeftParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != exprRightParen {
+			return nil, fmt.Errorf("expected ) at column %d, got %s", closing.column, closing)
+		}
+		return expr, nil
+	case exprString:
+		return &literalExpression{value: tok.text}, nil
+	case exprNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at column %d", tok.text, tok.column)
+		}
+		return &literalExpression{value: n}, nil
+	case exprName:
+		switch tok.text {
+		case "wahr", "true":
+			return &literalExpression{value: true}, nil
+		case "falsch", "false":
+			return &literalExpression{value: false}, nil
+		case "null", "nichts":
+			return &literalExpression{value: nil}, nil
+		case "und", "oder", "nicht":
+			return nil, fmt.Errorf("unexpected %s at column %d", tok, tok.column)
+		}
+		return &variableExpression{name: tok.text}, nil
+	}
+	return nil, fmt.Errorf("unexpected %s at column %d", tok, tok.column)
+}
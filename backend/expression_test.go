@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpressions(t *testing.T) {
+	scope := Variables{
+		"angemeldet": true,
+		"anzahl":     3.0,
+		"menge":      "12",
+		"sprache":    "de",
+		"leer":       "",
+		"liste":      []interface{}{},
+		"warenkorb":  map[string]interface{}{"leer": false, "summe": 19.5},
+	}
+	for _, test := range []struct {
+		source string
+		want   bool
+	}{
+		{"angemeldet", true},
+		{"nicht angemeldet", false},
+		{"!!angemeldet", true},
+		{"leer", false},
+		{"liste", false},
+		{"warenkorb", true},
+		{"nicht warenkorb.leer", true},
+		{"anzahl >= 3 und sprache == \"de\"", true},
+		{"anzahl > 3 || sprache == 'de'", true},
+		{"anzahl < 3 oder sprache != 'de'", false},
+		{"nicht anzahl == 3", false},
+		{"(anzahl == 1 oder anzahl == 3) und angemeldet", true},
+		{"anzahl == 1 oder anzahl == 3 und nicht angemeldet", false},
+
+		// Numeric text compares as a number, other text as text
+		{"menge > 9", true},
+		{"menge > '9'", false},
+		{"warenkorb.summe <= 19.5", true},
+
+		{"wahr && !falsch", true},
+		{"nichts == null", true},
+		{"sprache == nichts", false},
+		{"liste == liste", false},
+
+		// und and oder stop before an undefined variable
+		{"falsch und unbekannt.name", false},
+		{"wahr oder unbekannt", true},
+	} {
+		expr, err := parseExpression(test.source)
+		if err != nil {
+			t.Errorf("%s: %v", test.source, err)
+			continue
+		}
+		value, err := expr.eval(scope)
+		if err != nil {
+			t.Errorf("%s: %v", test.source, err)
+			continue
+		}
+		if got := truthy(value); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.source, got, test.want)
+		}
+	}
+}
+
+func TestExpressionParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		source, want string
+	}{
+		{"", "unexpected end of condition at column 1"},
+		{"anzahl >", "unexpected end of condition at column 9"},
+		{"a b", `unexpected "b" at column 3`},
+		{"(a", "expected ) at column 3, got end of condition"},
+		{"a)", `unexpected ")" at column 2`},
+		{"a == 'x", "unterminated string at column 6"},
+		{"ä = 1", `unexpected '=' at column 3`},
+		{"a und", "unexpected end of condition at column 6"},
+		{"und a", `unexpected "und" at column 1`},
+		{"1.2.3", `invalid number "1.2.3" at column 1`},
+		{"a < b < c", `unexpected "<" at column 7`},
+	} {
+		_, err := parseExpression(test.source)
+		if err == nil {
+			t.Errorf("%q: no error, want %q", test.source, test.want)
+		} else if err.Error() != test.want {
+			t.Errorf("%q: got %q, want %q", test.source, err, test.want)
+		}
+	}
+}
+
+func TestExpressionEvalErrors(t *testing.T) {
+	scope := Variables{"liste": []interface{}{1.0}, "wort": "x"}
+	for _, test := range []struct {
+		source, want string
+	}{
+		{"unbekannt", `undefined variable "unbekannt"`},
+		{"wahr und unbekannt", `undefined variable "unbekannt"`},
+		{"liste < 3", "cannot compare list < number"},
+		{"wort > wahr", "cannot compare text > boolean"},
+	} {
+		expr, err := parseExpression(test.source)
+		if err != nil {
+			t.Errorf("%s: %v", test.source, err)
+			continue
+		}
+		if _, err := expr.eval(scope); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want %q", test.source, err, test.want)
+		}
+	}
+}
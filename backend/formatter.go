@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+// FormatSource parses German HTML and prints it back with the original German
+// names, two-space indentation, double-quoted attribute values and id/class
+// first followed by the remaining attributes alphabetically. The dictionary
+// tells which names are HTML elements, and so which stay inline.
+func FormatSource(input string, dictionary *Dictionary) (string, error) {
+	parser := NewParser(NewLexer(input), dictionary)
+
+	document, err := parser.Parse()
+	if err != nil {
+		return "", fmt.Errorf("parsing error: %w", err)
+	}
+
+	// Front matter is kept exactly as written
+	_, _, length := splitFrontMatter(input)
+	frontMatter := string([]rune(input)[:length])
+
+	return frontMatter + Print(document, PrintOptions{Indent: "  ", SourceNames: true, SortAttributes: true}), nil
+}
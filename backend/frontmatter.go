@@ -0,0 +1,501 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Front matter is a block of metadata at the very top of a source, as YAML
+// between --- lines or TOML between +++ lines:
+//
+//	---
+//	titel: Startseite
+//	sprache: de
+//	vorlage: layouts/seite.dhtml
+//	---
+//
+// The lexer skips it; the transpiler exposes it in Result.FrontMatter and
+// makes every key available to {{ name }} placeholders.
+const (
+	FRONT_MATTER_YAML = "---"
+	FRONT_MATTER_TOML = "+++"
+)
+
+// Front matter keys the transpiler acts on, in German and English
+var (
+	frontMatterTitle    = []string{"titel", "title"}
+	frontMatterLanguage = []string{"sprache", "lang"}
+	frontMatterLayout   = []string{"vorlage", "layout"}
+)
+
+// NO_LAYOUT as the front-matter layout keeps a page out of the default layout
+const NO_LAYOUT = "keine"
+
+// splitFrontMatter finds a front matter block at the start of input. It
+// returns the fence, the block between the fences and the length of the
+// whole front matter in runes, or an empty fence when there is none.
+func splitFrontMatter(input string) (fence, block string, length int) {
+	for _, candidate := range []string{FRONT_MATTER_YAML, FRONT_MATTER_TOML} {
+		first, rest, found := strings.Cut(input, "\n")
+		if !found || strings.TrimRight(first, "\r") != candidate {
+			continue
+		}
+
+		// Find the closing fence on a line of its own
+		offset := len(first) + 1
+		for rest != "" {
+			line, next, _ := strings.Cut(rest, "\n")
+			if strings.TrimRight(line, "\r") == candidate {
+				end := offset + len(line)
+				if len(rest) > len(line) {
+					end++ // the closing fence's newline
+				}
+				block := input[len(first)+1 : offset]
+				return candidate, block, utf8.RuneCountInString(input[:end])
+			}
+			offset += len(line) + 1
+			rest = next
+		}
+	}
+	return "", "", 0
+}
+
+// ParseFrontMatter parses the front matter of a source; it returns nil
+// without front matter. Errors carry the line in the source.
+func ParseFrontMatter(filename, input string) (Variables, error) {
+	fence, block, _ := splitFrontMatter(input)
+	var values map[string]interface{}
+	var err error
+	switch fence {
+	case "":
+		return nil, nil
+	case FRONT_MATTER_YAML:
+		values, err = parseYAML(block)
+	default:
+		values, err = parseTOML(block)
+	}
+
+	if lineErr, ok := err.(*frontMatterError); ok {
+		// The block starts on the line after the opening fence
+		pos := Position{File: filename, Line: lineErr.line + 1, Column: 1}
+		return nil, &SyntaxError{Pos: pos, Message: "front matter: " + lineErr.message}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	return Variables(values), nil
+}
+
+// frontMatterValue returns the first of the given keys that is set
+func frontMatterValue(frontMatter Variables, keys []string) (string, bool) {
+	for _, key := range keys {
+		if value, exists := frontMatter[key]; exists {
+			text, err := formatValue(value)
+			return text, err == nil && text != ""
+		}
+	}
+	return "", false
+}
+
+// frontMatterError is a parse error at a line of the front matter block
+type frontMatterError struct {
+	line    int // 1-based, within the block
+	message string
+}
+
+func (e *frontMatterError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.message)
+}
+
+// metadataLine is a non-blank, non-comment line of a front matter block
+type metadataLine struct {
+	number int // 1-based, within the block
+	indent int
+	text   string // without indentation
+}
+
+// metadataLines splits a block into its meaningful lines
+func metadataLines(block string) []metadataLine {
+	var lines []metadataLine
+	for i, raw := range strings.Split(block, "\n") {
+		raw = strings.TrimRight(raw, " \t\r")
+		text := strings.TrimLeft(raw, " ")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		lines = append(lines, metadataLine{number: i + 1, indent: len(raw) - len(text), text: text})
+	}
+	return lines
+}
+
+// yamlParser parses the subset of YAML that front matter needs: nested
+// mappings and sequences by indentation, scalars, and flow lists like [a, b]
+type yamlParser struct {
+	lines []metadataLine
+	pos   int
+}
+
+func parseYAML(block string) (map[string]interface{}, error) {
+	p := &yamlParser{lines: metadataLines(block)}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	if p.lines[0].indent != 0 {
+		return nil, &frontMatterError{p.lines[0].number, "unexpected indentation"}
+	}
+	value, err := p.parseMapping(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, &frontMatterError{p.lines[p.pos].number, "unexpected indentation"}
+	}
+	return value, nil
+}
+
+// parseNode parses the mapping or sequence starting at the current line
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+	if isSequenceItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func (p *yamlParser) parseMapping(indent int) (map[string]interface{}, error) {
+	mapping := map[string]interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && !isSequenceItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		key, rest, found := splitYAMLKey(line.text)
+		if !found {
+			return nil, &frontMatterError{line.number, fmt.Sprintf("expected \"key: value\", got %q", line.text)}
+		}
+		if _, exists := mapping[key]; exists {
+			return nil, &frontMatterError{line.number, fmt.Sprintf("duplicate key %q", key)}
+		}
+		p.pos++
+
+		if rest != "" {
+			value, err := parseScalar(rest, line.number)
+			if err != nil {
+				return nil, err
+			}
+			mapping[key] = value
+			continue
+		}
+
+		// A nested block: deeper lines, or a sequence at the same indentation
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			if next.indent > indent || (next.indent == indent && isSequenceItem(next.text)) {
+				value, err := p.parseNode(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				mapping[key] = value
+				continue
+			}
+		}
+		mapping[key] = nil
+	}
+	return mapping, nil
+}
+
+func (p *yamlParser) parseSequence(indent int) ([]interface{}, error) {
+	sequence := []interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSequenceItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		item := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if item == "" {
+			// The item is the nested block on the following lines
+			p.pos++
+			if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+				sequence = append(sequence, nil)
+				continue
+			}
+			value, err := p.parseNode(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, value)
+			continue
+		}
+
+		if _, _, isMapping := splitYAMLKey(item); isMapping && !isQuoted(item) {
+			// "- name: x" starts a mapping whose keys line up with name
+			contentIndent := indent + len(line.text) - len(item)
+			p.lines[p.pos] = metadataLine{number: line.number, indent: contentIndent, text: item}
+			value, err := p.parseMapping(contentIndent)
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, value)
+			continue
+		}
+
+		value, err := parseScalar(item, line.number)
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, value)
+		p.pos++
+	}
+	return sequence, nil
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits "key: value" or "key:"; quoted keys are not supported
+func splitYAMLKey(text string) (string, string, bool) {
+	if strings.HasSuffix(text, ":") {
+		return strings.TrimSpace(strings.TrimSuffix(text, ":")), "", true
+	}
+	key, rest, found := strings.Cut(text, ": ")
+	if !found || strings.TrimSpace(key) == "" {
+		return "", "", false
+	}
+	return strings.TrimSpace(key), strings.TrimSpace(rest), true
+}
+
+// parseTOML parses the subset of TOML that front matter needs: key/value
+// pairs, [tabellen], [[listen von tabellen]], strings, numbers, booleans and
+// arrays
+func parseTOML(block string) (map[string]interface{}, error) {
+	root := map[string]interface{}{}
+	current := root
+	lines := metadataLines(block)
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		text := line.text
+
+		switch {
+		case strings.HasPrefix(text, "[["):
+			if !strings.HasSuffix(text, "]]") {
+				return nil, &frontMatterError{line.number, "unterminated table header"}
+			}
+			path := strings.Split(strings.TrimSpace(text[2:len(text)-2]), ".")
+			parent, err := tomlTable(root, path[:len(path)-1], line.number)
+			if err != nil {
+				return nil, err
+			}
+			name := path[len(path)-1]
+			list, _ := parent[name].([]interface{})
+			if _, exists := parent[name]; exists && list == nil {
+				return nil, &frontMatterError{line.number, fmt.Sprintf("%q is already defined", name)}
+			}
+			current = map[string]interface{}{}
+			parent[name] = append(list, current)
+
+		case strings.HasPrefix(text, "["):
+			if !strings.HasSuffix(text, "]") {
+				return nil, &frontMatterError{line.number, "unterminated table header"}
+			}
+			table, err := tomlTable(root, strings.Split(strings.TrimSpace(text[1:len(text)-1]), "."), line.number)
+			if err != nil {
+				return nil, err
+			}
+			current = table
+
+		default:
+			key, value, found := strings.Cut(text, "=")
+			if !found {
+				return nil, &frontMatterError{line.number, fmt.Sprintf("expected \"key = value\", got %q", text)}
+			}
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			if unquoted, err := unquoteTOML(key); err == nil {
+				key = unquoted
+			}
+
+			// Arrays may span lines until their brackets balance
+			for strings.HasPrefix(value, "[") && !balanced(value) && i+1 < len(lines) {
+				i++
+				value += " " + lines[i].text
+			}
+
+			parsed, err := parseScalar(value, line.number)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := current[key]; exists {
+				return nil, &frontMatterError{line.number, fmt.Sprintf("duplicate key %q", key)}
+			}
+			current[key] = parsed
+		}
+	}
+	return root, nil
+}
+
+// tomlTable returns the table at a dotted path, creating missing tables; for
+// a list of tables the last one is used
+func tomlTable(root map[string]interface{}, path []string, line int) (map[string]interface{}, error) {
+	table := root
+	for _, name := range path {
+		name = strings.TrimSpace(name)
+		switch existing := table[name].(type) {
+		case nil:
+			next := map[string]interface{}{}
+			table[name] = next
+			table = next
+		case map[string]interface{}:
+			table = existing
+		case []interface{}:
+			if len(existing) == 0 {
+				return nil, &frontMatterError{line, fmt.Sprintf("%q is an empty array, not a table", name)}
+			}
+			last, ok := existing[len(existing)-1].(map[string]interface{})
+			if !ok {
+				return nil, &frontMatterError{line, fmt.Sprintf("%q is not a table", name)}
+			}
+			table = last
+		default:
+			return nil, &frontMatterError{line, fmt.Sprintf("%q is not a table", name)}
+		}
+	}
+	return table, nil
+}
+
+// parseScalar parses a value shared by both formats: a quoted string, a
+// [flow, list], a number, a boolean, null, or plain text
+func parseScalar(text string, line int) (interface{}, error) {
+	text = stripComment(text)
+	switch {
+	case text == "":
+		return nil, nil
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, &frontMatterError{line, "unterminated list"}
+		}
+		items := []interface{}{}
+		for _, item := range splitList(text[1 : len(text)-1]) {
+			value, err := parseScalar(item, line)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	case isQuoted(text):
+		value, err := unquoteTOML(text)
+		if err != nil {
+			return nil, &frontMatterError{line, fmt.Sprintf("invalid string %s", text)}
+		}
+		return value, nil
+	case text == "true":
+		return true, nil
+	case text == "false":
+		return false, nil
+	case text == "null" || text == "~":
+		return nil, nil
+	}
+	if looksNumeric(text) {
+		if n, err := strconv.ParseFloat(strings.ReplaceAll(text, "_", ""), 64); err == nil {
+			return n, nil
+		}
+	}
+	return text, nil
+}
+
+// looksNumeric reports whether text is made of a sign, digits, a point, an
+// exponent and underscores, so "Inf" or "0x10" stay text
+func looksNumeric(text string) bool {
+	digits := strings.TrimLeft(text, "+-")
+	if digits == "" || digits[0] < '0' || digits[0] > '9' {
+		return false
+	}
+	return strings.Trim(digits, "0123456789._eE+-") == ""
+}
+
+func isQuoted(text string) bool {
+	return len(text) >= 2 && (text[0] == '"' || text[0] == '\'') && text[len(text)-1] == text[0]
+}
+
+// unquoteTOML removes the quotes of "basic" strings, with escapes, and
+// 'literal' strings, without
+func unquoteTOML(text string) (string, error) {
+	if !isQuoted(text) {
+		return "", fmt.Errorf("not quoted")
+	}
+	if text[0] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	return strconv.Unquote(text)
+}
+
+// stripComment removes a trailing " # comment" outside quotes
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return strings.TrimSpace(text[:i])
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// splitList splits the inside of a flow list at top-level commas
+func splitList(text string) []string {
+	var items []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			items = append(items, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(text[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+// balanced reports whether the brackets of a value outside quotes are closed
+func balanced(text string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		want  Variables
+	}{
+		{"<absatz/>", nil},
+		{"---\n---\n", Variables{}},
+		{"---\ntitel: Start # Kommentar\nzahl: 3\nan: true\nleer: ~\n---\n", Variables{"titel": "Start", "zahl": 3.0, "an": true, "leer": nil}},
+		{"---\nautor:\n  name: Ali\nliste:\n  - a\n  - \"b\"\nflach: [1, x]\n---\n", Variables{
+			"autor": map[string]interface{}{"name": "Ali"},
+			"liste": []interface{}{"a", "b"},
+			"flach": []interface{}{1.0, "x"},
+		}},
+		{"+++\ntitel = \"Start\"\nzahlen = [1,\n  2]\n[autor]\nname = 'Ali'\n+++\n", Variables{
+			"titel":  "Start",
+			"zahlen": []interface{}{1.0, 2.0},
+			"autor":  map[string]interface{}{"name": "Ali"},
+		}},
+		{"+++\n[[a.b]]\nx = 1\n[[a.b]]\nx = 2\n[a.b.c]\ny = 3\n+++\n", Variables{"a": map[string]interface{}{"b": []interface{}{
+			map[string]interface{}{"x": 1.0},
+			map[string]interface{}{"x": 2.0, "c": map[string]interface{}{"y": 3.0}},
+		}}}},
+	} {
+		got, err := ParseFrontMatter("", test.input)
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %#v, want %#v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParseFrontMatterErrors(t *testing.T) {
+	for _, test := range []struct {
+		input   string
+		line    int // in the source
+		message string
+	}{
+		{"+++\na = []\n[a.b]\n+++\n", 3, `"a" is an empty array`},
+		{"+++\na = []\n[[a.b]]\n+++\n", 3, `"a" is an empty array`},
+		{"+++\na = [1]\n[a.b]\n+++\n", 3, `"a" is not a table`},
+		{"+++\na = 1\n[a]\n+++\n", 3, `"a" is not a table`},
+		{"+++\n[a\n+++\n", 2, "unterminated table header"},
+		{"+++\n[[a]\n+++\n", 2, "unterminated table header"},
+		{"+++\na = 1\na = 2\n+++\n", 3, `duplicate key "a"`},
+		{"+++\na\n+++\n", 2, `expected "key = value"`},
+		{"+++\na = [1, 2\n+++\n", 2, "unterminated list"},
+		{"---\ntitel: a\ntitel: b\n---\n", 3, `duplicate key "titel"`},
+		{"---\n  eingerückt: ja\n---\n", 2, "unexpected indentation"},
+		{"---\nnur text\n---\n", 2, `expected "key: value"`},
+	} {
+		_, err := ParseFrontMatter("seite.dhtml", test.input)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%q: got %v, want a front matter error", test.input, err)
+			continue
+		}
+		if syntaxErr.Pos.Line != test.line || !strings.Contains(syntaxErr.Message, test.message) {
+			t.Errorf("%q: got %v, want line %d: %s", test.input, err, test.line, test.message)
+		}
+	}
+}
+
+func TestFrontMatterLanguageIsEscaped(t *testing.T) {
+	input := "---\nsprache: 'de\" onload=\"alert(1)'\n---\n<html><kopf></kopf></html>"
+	got, err := NewTranspiler().Transpile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, ` onload="`) || !strings.Contains(got, `lang="de&#34; onload=&#34;alert(1)"`) {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Grammar formats of "doner grammar"
+const (
+	GRAMMAR_TEXTMATE = "textmate"
+	GRAMMAR_VIM      = "vim"
+)
+
+// GRAMMAR_SCOPE is the TextMate scope name of German HTML sources
+const GRAMMAR_SCOPE = "text.html.doner"
+
+// textMateGrammar is the JSON shape of a TextMate grammar
+type textMateGrammar struct {
+	Name       string                   `json:"name"`
+	ScopeName  string                   `json:"scopeName"`
+	FileTypes  []string                 `json:"fileTypes"`
+	Comment    string                   `json:"comment"`
+	Patterns   []textMateRule           `json:"patterns"`
+	Repository map[string]*textMateRule `json:"repository"`
+}
+
+type textMateRule struct {
+	Name          string                  `json:"name,omitempty"`
+	Include       string                  `json:"include,omitempty"`
+	Match         string                  `json:"match,omitempty"`
+	Begin         string                  `json:"begin,omitempty"`
+	End           string                  `json:"end,omitempty"`
+	Captures      map[string]textMateRule `json:"captures,omitempty"`
+	BeginCaptures map[string]textMateRule `json:"beginCaptures,omitempty"`
+	EndCaptures   map[string]textMateRule `json:"endCaptures,omitempty"`
+	Patterns      []textMateRule          `json:"patterns,omitempty"`
+}
+
+// include refers to a rule in the grammar's repository
+func include(name string) textMateRule {
+	return textMateRule{Include: "#" + name}
+}
+
+// grammarNames returns the keys of a dictionary map, longest first so that
+// alternations prefer the longest name, then alphabetically
+func grammarNames(names map[string]string) []string {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	return sortGrammarNames(sorted)
+}
+
+func sortGrammarNames(names []string) []string {
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// regexpAlternation joins names into a regular expression alternation
+func regexpAlternation(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	return strings.Join(quoted, "|")
+}
+
+// TextMateGrammar generates a TextMate grammar for German HTML from the
+// dictionary: German tag and attribute names, the directives, placeholders,
+// entities and front matter each get their own scope
+func TextMateGrammar(d *Dictionary) ([]byte, error) {
+	directives := regexpAlternation(sortGrammarNames(append([]string(nil), directiveTags...)))
+	tags := regexpAlternation(grammarNames(d.tags))
+	attributes := regexpAlternation(grammarNames(d.attributes))
+	name := `[\p{L}\p{N}_:-]+`
+
+	grammar := textMateGrammar{
+		Name:      "German HTML",
+		ScopeName: GRAMMAR_SCOPE,
+		FileTypes: []string{"dhtml", "doner"},
+		Comment:   fmt.Sprintf("Generated by doner %s grammar from the dictionary; do not edit.", version),
+		Patterns:  []textMateRule{include("front-matter"), include("tag"), include("placeholder"), include("entity")},
+		Repository: map[string]*textMateRule{
+			"front-matter": {
+				Name:          "meta.embedded.front-matter.doner",
+				Begin:         `\A(---|\+\+\+)\s*$`,
+				End:           `^(\1)\s*$`,
+				BeginCaptures: map[string]textMateRule{"1": {Name: "punctuation.definition.front-matter.begin.doner"}},
+				EndCaptures:   map[string]textMateRule{"1": {Name: "punctuation.definition.front-matter.end.doner"}},
+				Patterns:      []textMateRule{include("placeholder")},
+			},
+			"tag": {
+				Name:  "meta.tag.doner",
+				Begin: `(</?)(?:(` + directives + `)|(` + tags + `)|(` + name + `))(?=[\s/>]|$)`,
+				End:   `(/?>)`,
+				BeginCaptures: map[string]textMateRule{
+					"1": {Name: "punctuation.definition.tag.begin.doner"},
+					"2": {Name: "keyword.control.directive.doner"},
+					"3": {Name: "entity.name.tag.doner"},
+					"4": {Name: "entity.name.tag.other.doner"},
+				},
+				EndCaptures: map[string]textMateRule{"1": {Name: "punctuation.definition.tag.end.doner"}},
+				Patterns:    []textMateRule{include("attribute"), include("string")},
+			},
+			"attribute": {
+				Match: `(?<=\s)(?:(` + attributes + `)|(` + name + `))(?=\s*=|\s|/?>|$)`,
+				Captures: map[string]textMateRule{
+					"1": {Name: "entity.other.attribute-name.doner"},
+					"2": {Name: "entity.other.attribute-name.other.doner"},
+				},
+			},
+			"string": {
+				Patterns: []textMateRule{
+					{Name: "string.quoted.double.doner", Begin: `"`, End: `"`, Patterns: []textMateRule{include("placeholder"), include("entity")}},
+					{Name: "string.quoted.single.doner", Begin: `'`, End: `'`, Patterns: []textMateRule{include("placeholder"), include("entity")}},
+				},
+			},
+			"placeholder": {
+				Name:  "variable.other.placeholder.doner",
+				Match: placeholderPattern.String(), // Go and Oniguruma read it alike
+			},
+			"entity": {
+				Name:  "constant.character.entity.doner",
+				Match: strings.TrimPrefix(entityPattern.String(), "^"),
+			},
+		},
+	}
+	// Keep <, > and & readable in the patterns
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(grammar); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// vimPatternEscaper escapes the characters that are special in a Vim pattern
+// in magic mode, and the quote delimiting it
+var vimPatternEscaper = strings.NewReplacer(
+	`\`, `\\`, `.`, `\.`, `*`, `\*`, `[`, `\[`, `]`, `\]`, `~`, `\~`, `^`, `\^`, `$`, `\$`, `"`, `\"`,
+)
+
+// vimAlternation joins names into a Vim pattern alternation
+func vimAlternation(names []string) string {
+	escaped := make([]string, len(names))
+	for i, name := range names {
+		escaped[i] = vimPatternEscaper.Replace(name)
+	}
+	return `\%(` + strings.Join(escaped, `\|`) + `\)`
+}
+
+// VimSyntax generates a Vim syntax file for German HTML from the dictionary,
+// with the same groups as the TextMate grammar
+func VimSyntax(d *Dictionary) string {
+	directives := vimAlternation(sortGrammarNames(append([]string(nil), directiveTags...)))
+	tags := vimAlternation(grammarNames(d.tags))
+	attributes := vimAlternation(grammarNames(d.attributes))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "\" Vim syntax file\n")
+	fmt.Fprintf(&out, "\" Language: German HTML (.dhtml, .doner)\n")
+	fmt.Fprintf(&out, "\" Generated by doner %s grammar from the dictionary; do not edit.\n", version)
+	fmt.Fprintf(&out, "\" Install as syntax/doner.vim and add:\n")
+	fmt.Fprintf(&out, "\"   autocmd BufRead,BufNewFile *.dhtml,*.doner setfiletype doner\n\n")
+	out.WriteString("if exists(\"b:current_syntax\")\n  finish\nendif\n\n")
+	out.WriteString("syn case match\n\n")
+
+	out.WriteString("syn region donerFrontMatter start=\"\\%1l---\\s*$\" end=\"^---\\s*$\" contains=donerPlaceholder\n")
+	out.WriteString("syn region donerFrontMatter start=\"\\%1l+++\\s*$\" end=\"^+++\\s*$\" contains=donerPlaceholder\n")
+	out.WriteString("syn match donerPlaceholder \"{{\\s*[^{}[:space:]]\\+\\s*}}\"\n")
+	out.WriteString("syn match donerEntity \"&\\%(#\\d\\+\\|#[xX]\\x\\+\\|\\a\\w*\\);\"\n\n")
+
+	out.WriteString("syn region donerTag matchgroup=donerTagDelimiter start=\"</\\?\\ze[^[:space:]/>]\" end=\"/\\?>\" contains=donerTagName,donerDirective,donerAttribute,donerString\n")
+	fmt.Fprintf(&out, "syn match donerTagName contained \"\\%%(</\\?\\)\\@<=%s\\ze\\%%([[:space:]/>]\\|$\\)\"\n", tags)
+	fmt.Fprintf(&out, "syn match donerDirective contained \"\\%%(</\\?\\)\\@<=%s\\ze\\%%([[:space:]/>]\\|$\\)\"\n", directives)
+	fmt.Fprintf(&out, "syn match donerAttribute contained \"\\%%(\\s\\)\\@<=%s\\ze\\%%(\\s*=\\|\\s\\|/\\?>\\|$\\)\"\n", attributes)
+	out.WriteString("syn region donerString contained start=+\"+ end=+\"+ contains=donerPlaceholder,donerEntity\n")
+	out.WriteString("syn region donerString contained start=+'+ end=+'+ contains=donerPlaceholder,donerEntity\n\n")
+
+	for _, link := range [][2]string{
+		{"donerFrontMatter", "Comment"},
+		{"donerPlaceholder", "Identifier"},
+		{"donerEntity", "Special"},
+		{"donerTagDelimiter", "Function"},
+		{"donerTagName", "Statement"},
+		{"donerDirective", "PreProc"},
+		{"donerAttribute", "Type"},
+		{"donerString", "String"},
+	} {
+		fmt.Fprintf(&out, "hi def link %s %s\n", link[0], link[1])
+	}
+	out.WriteString("\nlet b:current_syntax = \"doner\"\n")
+	return out.String()
+}
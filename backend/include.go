@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The include directive: <einbinden quelle="teile/kopf.dhtml" />
+const (
+	INCLUDE_TAG       = "einbinden"
+	INCLUDE_ATTRIBUTE = "quelle"
+)
+
+// MAX_INCLUDE_DEPTH limits how deeply includes may nest
+const MAX_INCLUDE_DEPTH = 16
+
+// IncludeError is a failed include or layout. It points at the directive in
+// the including file and wraps the error from the included one.
+type IncludeError struct {
+	Pos    Position // the <einbinden> or <vorlage> element
+	Path   string   // the included file as written in quelle
+	Layout bool     // whether the directive was a <vorlage>
+	Err    error
+}
+
+func (e *IncludeError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Pos, e.action(), e.Err)
+}
+
+// action describes what the directive was doing, e.g. "including teile/kopf.dhtml"
+func (e *IncludeError) action() string {
+	if e.Layout {
+		return "using layout " + e.Path
+	}
+	return "including " + e.Path
+}
+
+func (e *IncludeError) Unwrap() error {
+	return e.Err
+}
+
+// errIncludesDisabled is returned for includes when the transpiler may not read files
+var errIncludesDisabled = errors.New("includes are not enabled")
+
+// includeState carries what expandIncludes needs while descending into
+// included files
+type includeState struct {
+	stack        []string // absolute paths of the files being expanded, outermost first
+	dependencies []string // every file read, as absolute paths
+}
+
+// expandIncludes replaces the <einbinden> elements of a document parsed from
+// filename with the contents of the files they name, recursively
+func (t *Transpiler) expandIncludes(document *Document, filename string, state *includeState) error {
+	var failure error
+	Rewrite(document, func(node Node) Node {
+		element, ok := node.(*Element)
+		if !ok || failure != nil || element.SourceName != INCLUDE_TAG {
+			return node
+		}
+
+		included, err := t.include(element, filename, state)
+		if err != nil {
+			failure = &IncludeError{Pos: element.Pos, Path: includePath(element), Err: err}
+			return node
+		}
+		return included
+	})
+	return failure
+}
+
+// include reads, parses and expands the file an <einbinden> element names
+func (t *Transpiler) include(element *Element, filename string, state *includeState) (*Document, error) {
+	if len(element.Children) > 0 {
+		return nil, fmt.Errorf("<%s> must be empty", INCLUDE_TAG)
+	}
+	source := includePath(element)
+	if source == "" {
+		return nil, fmt.Errorf("<%s> needs a %s attribute", INCLUDE_TAG, INCLUDE_ATTRIBUTE)
+	}
+	return t.load(filename, source, state)
+}
+
+// load reads and parses a file named from filename and expands its includes
+// and layouts. It is shared by includes and layouts, so both count towards the
+// depth limit and cycles through either are caught.
+func (t *Transpiler) load(filename, source string, state *includeState) (*Document, error) {
+	if t.noIncludes {
+		return nil, errIncludesDisabled
+	}
+	if len(state.stack) >= MAX_INCLUDE_DEPTH {
+		return nil, fmt.Errorf("includes nested more than %d levels deep", MAX_INCLUDE_DEPTH)
+	}
+
+	path, err := t.resolveInclude(filename, source)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, including := range state.stack {
+		if including == abs {
+			cycle := append(append([]string{}, state.stack[i:]...), abs)
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(cycle, " → "))
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state.dependencies = append(state.dependencies, abs)
+	if len(content) > MAX_INPUT_SIZE {
+		return nil, fmt.Errorf("%s is too large (max %d bytes)", path, MAX_INPUT_SIZE)
+	}
+
+	// Front matter of included files and layouts is skipped but not used
+	document, _, err := t.parse(path, string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	state.stack = append(state.stack, abs)
+	defer func() { state.stack = state.stack[:len(state.stack)-1] }()
+	if err := t.expand(document, path, state); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// expand resolves the includes and then the layouts of a document
+func (t *Transpiler) expand(document *Document, filename string, state *includeState) error {
+	if err := t.expandIncludes(document, filename, state); err != nil {
+		return err
+	}
+	return t.expandLayouts(document, filename, state)
+}
+
+// resolveInclude turns the quelle of an include into a file path. Paths are
+// relative to the including file, or to the include root for sources without
+// a file. With a root, paths that leave it are rejected.
+func (t *Transpiler) resolveInclude(filename, source string) (string, error) {
+	dir := t.includeRoot
+	if filename != "" && filename != STDIN_NAME {
+		dir = filepath.Dir(filename)
+	}
+	path := filepath.Join(dir, filepath.FromSlash(source))
+	if t.includeRoot == "" {
+		return path, nil
+	}
+
+	// Check the path as written, then the real path so symlinks cannot point
+	// out of the root either
+	outside := fmt.Errorf("%s is outside the include root", source)
+	if !within(t.includeRoot, path) {
+		return "", outside
+	}
+	root, err := filepath.EvalSymlinks(t.includeRoot)
+	if err != nil {
+		return "", err
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%s does not exist", source)
+	} else if err != nil {
+		return "", err
+	}
+	if !within(root, real) {
+		return "", outside
+	}
+	return path, nil
+}
+
+// within reports whether path lies inside the directory root
+func within(root, path string) bool {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// includePath returns the quelle attribute of an include or layout directive
+func includePath(element *Element) string {
+	return sourceAttribute(element, INCLUDE_ATTRIBUTE)
+}
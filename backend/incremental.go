@@ -0,0 +1,209 @@
+package main
+
+import "fmt"
+
+// TextEdit replaces the runes from Start up to End of a source with Text
+type TextEdit struct {
+	Start int // rune offset in the source before the edit
+	End   int
+	Text  string
+}
+
+// IncrementalParser keeps the AST of a source up to date while it is edited,
+// for the language server and live previews. An edit inside an element
+// relexes and reparses just that element; the other subtrees of the previous
+// Document are reused, with the positions after the edit moved. Edits
+// outside any element, in front matter, or that change where an element ends
+// reparse the whole source.
+type IncrementalParser struct {
+	dictionary  *Dictionary
+	filename    string
+	source      []rune
+	frontMatter int // length of the front matter in runes
+	document    *Document
+	err         error
+}
+
+// NewIncrementalParser parses source and keeps it for later edits
+func NewIncrementalParser(filename, source string, dictionary *Dictionary) *IncrementalParser {
+	p := &IncrementalParser{dictionary: dictionary, filename: filename}
+	p.Reset(source)
+	return p
+}
+
+// Document returns the current AST, or the syntax error of the current source
+func (p *IncrementalParser) Document() (*Document, error) {
+	return p.document, p.err
+}
+
+// Source returns the current source
+func (p *IncrementalParser) Source() string {
+	return string(p.source)
+}
+
+// Reset replaces the whole source and parses it again
+func (p *IncrementalParser) Reset(source string) (*Document, error) {
+	p.source = []rune(source)
+	p.parseAll()
+	return p.document, p.err
+}
+
+// parseAll parses the whole source
+func (p *IncrementalParser) parseAll() {
+	source := string(p.source)
+	_, _, p.frontMatter = splitFrontMatter(source)
+	parser := NewParser(NewLexer(source), p.dictionary)
+	parser.SetFilename(p.filename)
+	p.document, p.err = parser.Parse()
+}
+
+// Apply applies edits and updates the AST in place. Edits given together
+// apply one after another, each to the source the previous one left, as in
+// LSP.
+func (p *IncrementalParser) Apply(edits ...TextEdit) (*Document, error) {
+	for _, edit := range edits {
+		if edit.Start < 0 || edit.Start > edit.End || edit.End > len(p.source) {
+			return nil, fmt.Errorf("edit %d-%d is outside the source of %d characters", edit.Start, edit.End, len(p.source))
+		}
+		p.apply(edit)
+	}
+	return p.document, p.err
+}
+
+// apply applies one edit
+func (p *IncrementalParser) apply(edit TextEdit) {
+	inserted := []rune(edit.Text)
+	source := make([]rune, 0, len(p.source)-(edit.End-edit.Start)+len(inserted))
+	source = append(source, p.source[:edit.Start]...)
+	source = append(source, inserted...)
+	p.source = append(source, p.source[edit.End:]...)
+
+	// An unclosed fence at the start may become front matter with any edit
+	head := string(p.source[:min(len(p.source), len(FRONT_MATTER_YAML))])
+	startsWithFence := head == FRONT_MATTER_YAML || head == FRONT_MATTER_TOML
+	if p.err != nil || edit.Start <= p.frontMatter || (p.frontMatter == 0 && startsWithFence) {
+		p.parseAll()
+		return
+	}
+
+	path := enclosingElements(p.document.Children, edit.Start, edit.End)
+	if len(path) == 0 {
+		p.parseAll()
+		return
+	}
+	target := path[len(path)-1]
+	element, ok := p.parseElementAt(target.Pos, target.End.Offset+len(inserted)-(edit.End-edit.Start))
+	if !ok {
+		p.parseAll()
+		return
+	}
+
+	shift := positionShift{
+		from:    target.End,
+		offset:  element.End.Offset - target.End.Offset,
+		lines:   element.End.Line - target.End.Line,
+		columns: element.End.Column - target.End.Column,
+	}
+	siblings := &p.document.Children
+	for depth, enclosing := range path {
+		index := indexOfNode(*siblings, enclosing)
+		for _, after := range (*siblings)[index+1:] {
+			shift.node(after)
+		}
+		if depth == len(path)-1 {
+			(*siblings)[index] = element
+			break
+		}
+		enclosing.End = shift.position(enclosing.End)
+		siblings = &enclosing.Children
+	}
+}
+
+// parseElementAt parses the source from start up to end, which must hold a
+// single element and nothing else
+func (p *IncrementalParser) parseElementAt(start Position, end int) (*Element, bool) {
+	if end > len(p.source) || end <= start.Offset {
+		return nil, false
+	}
+	parser := NewParser(newLexerAt(p.source, start, end), p.dictionary)
+	parser.SetFilename(p.filename)
+	document, err := parser.Parse()
+	if err != nil || len(document.Children) != 1 {
+		return nil, false
+	}
+	element, ok := document.Children[0].(*Element)
+	if !ok || element.End.Offset != end {
+		return nil, false
+	}
+	return element, true
+}
+
+// enclosingElements returns the elements that contain the runes from start up
+// to end, outermost first. The edited text must lie after an element's '<'
+// and before its last '>'; text inserted right before or after an element
+// belongs to its parent.
+func enclosingElements(nodes []Node, start, end int) []*Element {
+	for _, node := range nodes {
+		element, ok := node.(*Element)
+		if !ok || !element.End.IsValid() {
+			continue
+		}
+		if element.Pos.Offset < start && end < element.End.Offset {
+			return append([]*Element{element}, enclosingElements(element.Children, start, end)...)
+		}
+	}
+	return nil
+}
+
+// indexOfNode returns the index of node in nodes
+func indexOfNode(nodes []Node, node Node) int {
+	for i, candidate := range nodes {
+		if candidate == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// positionShift moves the positions after an edited element by the change in
+// its length: every position moves by offset runes and lines lines, and those
+// on the line where the element ended also by columns
+type positionShift struct {
+	from    Position
+	offset  int
+	lines   int
+	columns int
+}
+
+// position shifts one position
+func (s positionShift) position(pos Position) Position {
+	if !pos.IsValid() || pos.Offset < s.from.Offset {
+		return pos
+	}
+	if pos.Line == s.from.Line {
+		pos.Column += s.columns
+	}
+	pos.Offset += s.offset
+	pos.Line += s.lines
+	return pos
+}
+
+// node shifts the positions of a subtree
+func (s positionShift) node(node Node) {
+	Inspect(node, func(node Node) bool {
+		switch n := node.(type) {
+		case *Element:
+			n.Pos = s.position(n.Pos)
+			n.End = s.position(n.End)
+			for _, attr := range n.Attributes {
+				attr.Pos = s.position(attr.Pos)
+				attr.ValuePos = s.position(attr.ValuePos)
+			}
+		case *TextNode:
+			n.Pos = s.position(n.Pos)
+		case *CommentNode:
+			n.Pos = s.position(n.Pos)
+		}
+		return true
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const incrementalSource = `---
+titel: Start
+---
+<abschnitt klasse="haupt">
+  <überschrift1>Willkommen</überschrift1>
+  <absatz>Erste Zeile
+    zweite <fett>fette</fett> Zeile</absatz>
+  <liste>
+    <punkt>eins</punkt>
+    <punkt titel='zwei'>zwei</punkt>
+  </liste>
+  <bild quelle="a.png" alt="A"/>
+</abschnitt>
+<fuß>Ende</fuß>
+`
+
+// checkIncremental compares the incrementally updated AST with a full parse
+// of the same source
+func checkIncremental(t *testing.T, p *IncrementalParser, step string) {
+	t.Helper()
+	document, err := p.Document()
+	parser := NewParser(NewLexer(p.Source()), NewDictionary())
+	parser.SetFilename("seite.dhtml")
+	want, wantErr := parser.Parse()
+	if (err != nil) != (wantErr != nil) {
+		t.Fatalf("%s: error %v, full parse %v\n%s", step, err, wantErr, p.Source())
+	}
+	if err == nil && !reflect.DeepEqual(document, want) {
+		t.Fatalf("%s: AST differs from a full parse of\n%s", step, p.Source())
+	}
+}
+
+// edit returns the edit replacing the first occurrence of old in source
+func edit(t *testing.T, source, old, text string) TextEdit {
+	t.Helper()
+	i := strings.Index(source, old)
+	if i < 0 {
+		t.Fatalf("%q not in source", old)
+	}
+	start := len([]rune(source[:i]))
+	return TextEdit{Start: start, End: start + len([]rune(old)), Text: text}
+}
+
+func TestIncrementalParserEdits(t *testing.T) {
+	for _, test := range []struct {
+		name, old, text string
+	}{
+		{"text", "Willkommen", "Hallo und willkommen"},
+		{"text over lines", "Erste Zeile\n    zweite", "Eine\n\n\n    neue"},
+		{"attribute value", "'zwei'", "'zwei und mehr'"},
+		{"new element", "<punkt>eins</punkt>", "<punkt>eins</punkt>\n    <punkt>\n      neu</punkt>"},
+		{"tag name", "<fett>fette</fett>", "<kursiv>fette</kursiv>"},
+		{"delete element", "\n  <bild quelle=\"a.png\" alt=\"A\"/>", ""},
+		{"broken", "</fett>", "</fet"},
+		{"front matter", "Start", "Neu"},
+		{"outside elements", "<fuß>", "Text <fuß>"},
+	} {
+		p := NewIncrementalParser("seite.dhtml", incrementalSource, NewDictionary())
+		p.Apply(edit(t, incrementalSource, test.old, test.text))
+		checkIncremental(t, p, test.name)
+		if got, want := p.Source(), strings.Replace(incrementalSource, test.old, test.text, 1); got != want {
+			t.Fatalf("%s: source %q, want %q", test.name, got, want)
+		}
+	}
+}
+
+func TestIncrementalParserTyping(t *testing.T) {
+	p := NewIncrementalParser("seite.dhtml", incrementalSource, NewDictionary())
+	at := edit(t, incrementalSource, "fette", "").Start
+	typed := []rune("sehr <kursiv>schräge</kursiv> und ")
+	for i, r := range typed {
+		p.Apply(TextEdit{Start: at + i, End: at + i, Text: string(r)})
+		checkIncremental(t, p, "typing "+string(r))
+	}
+	for range typed {
+		p.Apply(TextEdit{Start: at, End: at + 1})
+		checkIncremental(t, p, "deleting")
+	}
+	if p.Source() != incrementalSource {
+		t.Fatalf("source after undoing: %q", p.Source())
+	}
+}
+
+func TestIncrementalParserRandomEdits(t *testing.T) {
+	fragments := []string{"x", " ", "\n", "ü", "<", ">", "/", "\"", "<fett>", "</fett>", "<absatz>a</absatz>", `klasse="k"`, "{{ titel }}", "<bild/>", "😀"}
+	random := rand.New(rand.NewSource(1))
+	p := NewIncrementalParser("seite.dhtml", incrementalSource, NewDictionary())
+	for i := 0; i < 2000; i++ {
+		source := []rune(p.Source())
+		if i%200 == 0 {
+			p.Reset(incrementalSource) // recover from accumulated damage
+			source = []rune(incrementalSource)
+		}
+		start := random.Intn(len(source) + 1)
+		end := min(len(source), start+random.Intn(4))
+		text := ""
+		if random.Intn(3) > 0 {
+			text = fragments[random.Intn(len(fragments))]
+		}
+		if _, err := p.Apply(TextEdit{Start: start, End: end, Text: text}); err != nil && strings.Contains(err.Error(), "outside the source") {
+			t.Fatal(err)
+		}
+		checkIncremental(t, p, "random edit")
+	}
+}
+
+func TestIncrementalParserRejectsEditsOutsideTheSource(t *testing.T) {
+	p := NewIncrementalParser("", "<absatz/>", NewDictionary())
+	for _, e := range []TextEdit{{Start: -1, End: 0}, {Start: 3, End: 2}, {Start: 0, End: 10}} {
+		if _, err := p.Apply(e); err == nil {
+			t.Errorf("%+v: no error", e)
+		}
+	}
+}
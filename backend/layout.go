@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Layout directives. A page wraps its content in
+// <vorlage quelle="layout.dhtml">, fills slots with <füllen platz="name">
+// blocks, and the layout marks where they go with <platz name="name" />.
+const (
+	LAYOUT_TAG       = "vorlage"
+	SLOT_TAG         = "platz"
+	SLOT_ATTRIBUTE   = "name"
+	FILL_TAG         = "füllen"
+	FILL_ATTRIBUTE   = "platz"
+	DEFAULT_SLOT     = "" // <platz /> without a name; takes content outside <füllen> blocks
+	defaultSlotLabel = "(default)"
+)
+
+// expandLayouts replaces each <vorlage> element of a document parsed from
+// filename with its layout, filled with the content of the element
+func (t *Transpiler) expandLayouts(document *Document, filename string, state *includeState) error {
+	var failure error
+	Rewrite(document, func(node Node) Node {
+		element, ok := node.(*Element)
+		if !ok || failure != nil || element.SourceName != LAYOUT_TAG {
+			return node
+		}
+
+		merged, err := t.layout(element, filename, state)
+		if err != nil {
+			failure = err
+			return node
+		}
+		return merged
+	})
+	return failure
+}
+
+// layout loads the layout a <vorlage> element names and puts the page's
+// content into its slots
+func (t *Transpiler) layout(element *Element, filename string, state *includeState) (*Document, error) {
+	source := includePath(element)
+	if source == "" {
+		return nil, &SyntaxError{Pos: element.Pos, Message: fmt.Sprintf("<%s> needs a %s attribute", LAYOUT_TAG, INCLUDE_ATTRIBUTE)}
+	}
+
+	fills, err := collectFills(element)
+	if err != nil {
+		return nil, err
+	}
+
+	layout, err := t.load(filename, source, state)
+	if err != nil {
+		return nil, &IncludeError{Pos: element.Pos, Path: source, Layout: true, Err: err}
+	}
+
+	slots, err := collectSlots(layout)
+	if err != nil {
+		return nil, &IncludeError{Pos: element.Pos, Path: source, Layout: true, Err: err}
+	}
+	for name, fill := range fills {
+		if !slots[name] {
+			return nil, &SyntaxError{Pos: fill.pos, Message: unknownSlotMessage(source, name, slots)}
+		}
+	}
+
+	layout.Children = fillSlots(layout.Children, fills)
+	return layout, nil
+}
+
+// fillSlots replaces the <platz> elements among nodes with the page's
+// content; slots the page leaves empty keep the layout's fallback content.
+// Component definitions are left alone, their <platz> is their own.
+func fillSlots(nodes []Node, fills map[string]*fill) []Node {
+	var result []Node
+	for _, node := range nodes {
+		element, ok := node.(*Element)
+		switch {
+		case !ok || element.SourceName == COMPONENT_TAG:
+			result = append(result, node)
+		case element.SourceName == SLOT_TAG:
+			if fill, filled := fills[slotName(element)]; filled {
+				result = append(result, fill.content...)
+			} else {
+				result = append(result, fillSlots(element.Children, fills)...)
+			}
+		default:
+			element.Children = fillSlots(element.Children, fills)
+			result = append(result, element)
+		}
+	}
+	return result
+}
+
+// fill is the content a page provides for one slot
+type fill struct {
+	pos     Position // the <füllen> block, or the first node for the default slot
+	content []Node
+}
+
+// collectFills sorts the children of a <vorlage> element into slots:
+// <füllen> blocks by their platz attribute, everything else into the
+// default slot
+func collectFills(element *Element) (map[string]*fill, error) {
+	fills := map[string]*fill{}
+	add := func(name string, pos Position, content ...Node) error {
+		if existing, exists := fills[name]; exists {
+			if name != DEFAULT_SLOT || existing.explicit() || isFillBlock(content) {
+				return &SyntaxError{Pos: pos, Message: fmt.Sprintf("slot %s is filled twice", slotLabel(name))}
+			}
+			existing.content = append(existing.content, content...)
+			return nil
+		}
+		fills[name] = &fill{pos: pos, content: content}
+		return nil
+	}
+
+	for _, child := range element.Children {
+		block, ok := child.(*Element)
+		if ok && block.SourceName == FILL_TAG {
+			if err := add(fillName(block), block.Pos, block); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if isBlankText(child) {
+			continue
+		}
+		if err := add(DEFAULT_SLOT, nodePosition(child), child); err != nil {
+			return nil, err
+		}
+	}
+
+	// Unwrap the <füllen> blocks
+	for _, f := range fills {
+		if f.explicit() {
+			f.content = f.content[0].(*Element).Children
+		}
+	}
+	return fills, nil
+}
+
+// explicit reports whether the fill is a single <füllen> block rather than
+// loose content
+func (f *fill) explicit() bool {
+	return isFillBlock(f.content)
+}
+
+func isFillBlock(content []Node) bool {
+	if len(content) != 1 {
+		return false
+	}
+	block, ok := content[0].(*Element)
+	return ok && block.SourceName == FILL_TAG
+}
+
+// collectSlots returns the slot names a layout declares
+func collectSlots(layout *Document) (map[string]bool, error) {
+	slots := map[string]bool{}
+	var failure error
+	Inspect(layout, func(node Node) bool {
+		slot, ok := node.(*Element)
+		if ok && slot.SourceName == COMPONENT_TAG {
+			return false
+		}
+		if !ok || slot.SourceName != SLOT_TAG || failure != nil {
+			return failure == nil
+		}
+		name := slotName(slot)
+		if slots[name] {
+			failure = &SyntaxError{Pos: slot.Pos, Message: fmt.Sprintf("slot %s is declared twice", slotLabel(name))}
+			return false
+		}
+		slots[name] = true
+		return true
+	})
+	return slots, failure
+}
+
+// unknownSlotMessage explains that a page filled a slot the layout lacks
+func unknownSlotMessage(layout, name string, slots map[string]bool) string {
+	var names []string
+	for slot := range slots {
+		names = append(names, slotLabel(slot))
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return fmt.Sprintf("layout %s has no slots, cannot fill %s", layout, slotLabel(name))
+	}
+	return fmt.Sprintf("layout %s has no slot %s (slots: %s)", layout, slotLabel(name), strings.Join(names, ", "))
+}
+
+// slotLabel quotes a slot name for messages
+func slotLabel(name string) string {
+	if name == DEFAULT_SLOT {
+		return defaultSlotLabel
+	}
+	return fmt.Sprintf("%q", name)
+}
+
+func slotName(slot *Element) string {
+	return sourceAttribute(slot, SLOT_ATTRIBUTE)
+}
+
+func fillName(block *Element) string {
+	return sourceAttribute(block, FILL_ATTRIBUTE)
+}
+
+// sourceAttribute returns the value of an attribute by its German name
+func sourceAttribute(element *Element, name string) string {
+	if attr := findSourceAttribute(element, name); attr != nil {
+		return attr.Value
+	}
+	return ""
+}
+
+// findSourceAttribute returns an attribute by its German name, or nil
+func findSourceAttribute(element *Element, name string) *Attribute {
+	for _, attr := range element.Attributes {
+		if attr.SourceName == name {
+			return attr
+		}
+	}
+	return nil
+}
+
+// nodePosition returns where a node starts in its source
+func nodePosition(node Node) Position {
+	switch n := node.(type) {
+	case *Element:
+		return n.Pos
+	case *TextNode:
+		return n.Pos
+	case *CommentNode:
+		return n.Pos
+	}
+	return Position{}
+}
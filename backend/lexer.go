@@ -34,7 +34,10 @@ const (
 type Token struct {
 	Type     TokenType
 	Value    string
-	Position int
+	Position int  // rune offset
+	Line     int  // 1-based
+	Column   int  // 1-based, in runes
+	Quote    rune // quote around an attribute value, 0 when unquoted
 }
 
 // Lexer tokenizes German HTML input
@@ -45,18 +48,50 @@ type Lexer struct {
 	insideTag       bool
 	afterTagName    bool    // Track if we just read a tag name
 	afterEquals     bool    // Track if we just read an equals sign
+	line            int     // Line of the current character
+	column          int     // Column of the current character
+	
+	// Raw text elements: the content of <markdown> and of elements with
+	// format="markdown" is read as one text token, without tags
+	closingTag      bool    // Track if the tag being read is an end tag
+	tagName         string  // Name of the tag being read
+	attrName        string  // Name of the last attribute read
+	rawFormat       bool    // Track if the tag being read has format="markdown"
+	rawUntil        string  // Name of the raw text element whose content comes next
+	textContinues   bool    // Track if the last text token was cut at MAX_TOKEN_LENGTH
 }
 
 // NewLexer creates a new lexer instance
 func NewLexer(input string) *Lexer {
 	runes := []rune(input)
-	l := &Lexer{input: runes, insideTag: false, afterTagName: false, afterEquals: false}
+	l := &Lexer{input: runes, insideTag: false, afterTagName: false, afterEquals: false, line: 1}
+	l.readChar()
+	
+	// Skip front matter; positions still count from the start of the input
+	_, _, length := splitFrontMatter(input)
+	for i := 0; i < length; i++ {
+		l.readChar()
+	}
+	return l
+}
+
+// newLexerAt creates a lexer for the part of input from start up to the rune
+// offset end, which must begin outside any tag. Token positions still count
+// from the start of input.
+func newLexerAt(input []rune, start Position, end int) *Lexer {
+	l := &Lexer{input: input[:end], position: start.Offset, line: start.Line, column: start.Column - 1}
 	l.readChar()
 	return l
 }
 
 // readChar reads the next character and advances position
 func (l *Lexer) readChar() {
+	if l.current == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+	
 	if l.position >= len(l.input) {
 		l.current = 0 // EOF
 	} else {
@@ -107,18 +142,22 @@ func (l *Lexer) readText() string {
 	position := l.position - 1
 	originalPos := position
 	
+	l.textContinues = false
 	for l.current != '<' && l.current != 0 {
 		l.readChar()
 		// Security: Break large text into smaller chunks
 		if (l.position - originalPos) > MAX_TOKEN_LENGTH {
+			l.textContinues = l.current != '<' && l.current != 0
 			break
 		}
 	}
 	
-	text := l.input[position : l.position-1]
-	l.position-- // Go back one position so we don't skip the '<'
-	l.readChar()
-	return strings.TrimSpace(string(text))
+	// A chunk keeps the whitespace at the cut, so the chunks add up to the text
+	text := string(l.input[position : l.position-1])
+	if l.textContinues {
+		return text
+	}
+	return strings.TrimRightFunc(text, unicode.IsSpace)
 }
 
 // readUnquotedValue reads an unquoted attribute value
@@ -131,19 +170,49 @@ func (l *Lexer) readUnquotedValue() string {
 	return string(l.input[position : l.position-1])
 }
 
+// readRawText reads everything up to the end tag of the raw text element,
+// keeping whitespace, and returns it with the position where it starts
+func (l *Lexer) readRawText() Token {
+	tok := Token{Type: TOKEN_TEXT, Position: l.position - 1, Line: l.line, Column: l.column}
+	end := []rune("</" + l.rawUntil)
+	l.rawUntil = ""
+	
+	start := l.position - 1
+	for l.current != 0 {
+		if l.current == '<' && l.position-1+len(end) <= len(l.input) && string(l.input[l.position-1:l.position-1+len(end)]) == string(end) {
+			break
+		}
+		l.readChar()
+	}
+	tok.Value = string(l.input[start : l.position-1])
+	return tok
+}
+
 // NextToken returns the next token from the input
 func (l *Lexer) NextToken() Token {
 	var tok Token
 	
+	// The content of a raw text element is one token, unless it is blank
+	if l.rawUntil != "" && !l.insideTag {
+		if tok = l.readRawText(); strings.TrimSpace(tok.Value) != "" {
+			return tok
+		}
+	}
+	
 	// If we're not inside a tag and we encounter text content
 	if !l.insideTag && l.current != '<' && l.current != 0 {
+		if !l.textContinues {
+			l.skipWhitespace() // text is trimmed, so start at its first visible character
+		}
 		tok.Type = TOKEN_TEXT
 		tok.Position = l.position - 1
+		tok.Line, tok.Column = l.line, l.column
 		tok.Value = l.readText()
 		return tok
 	}
 
 	l.skipWhitespace()
+	line, column := l.line, l.column
 
 	switch l.current {
 	case '<':
@@ -153,15 +222,21 @@ func (l *Lexer) NextToken() Token {
 			l.insideTag = true
 			l.afterTagName = false
 			l.afterEquals = false
+			l.closingTag = true
 			tok = Token{Type: TOKEN_TAG_END, Value: "</", Position: l.position - 2}
 		} else {
 			l.insideTag = true
 			l.afterTagName = false
 			l.afterEquals = false
+			l.closingTag = false
+			l.rawFormat = false
 			tok = Token{Type: TOKEN_TAG_OPEN, Value: "<", Position: l.position - 1}
 			l.readChar()
 		}
 	case '>':
+		if l.insideTag && !l.closingTag && (l.tagName == MARKDOWN_TAG || l.rawFormat) {
+			l.rawUntil = l.tagName
+		}
 		l.insideTag = false
 		l.afterTagName = false
 		l.afterEquals = false
@@ -188,13 +263,17 @@ func (l *Lexer) NextToken() Token {
 		tok.Type = TOKEN_ATTR_VALUE
 		tok.Position = l.position - 1
 		tok.Value = l.readString('"')
+		tok.Quote = '"'
 		l.readChar() // consume closing quote
+		l.noteAttributeValue(tok.Value)
 	case '\'':
 		l.afterEquals = false
 		tok.Type = TOKEN_ATTR_VALUE
 		tok.Position = l.position - 1
 		tok.Value = l.readString('\'')
+		tok.Quote = '\''
 		l.readChar() // consume closing quote
+		l.noteAttributeValue(tok.Value)
 	case 0:
 		tok = Token{Type: TOKEN_EOF, Value: "", Position: l.position}
 	default:
@@ -213,10 +292,16 @@ func (l *Lexer) NextToken() Token {
 			}
 			tok.Position = l.position - 1
 			
-			if tok.Type == TOKEN_ATTR_VALUE {
+			switch tok.Type {
+			case TOKEN_ATTR_VALUE:
 				tok.Value = l.readUnquotedValue()
-			} else {
+				l.noteAttributeValue(tok.Value)
+			case TOKEN_ATTR_NAME:
+				tok.Value = l.readIdentifier()
+				l.attrName = tok.Value
+			default:
 				tok.Value = l.readIdentifier()
+				l.tagName = tok.Value
 			}
 		} else {
 			tok = Token{Type: TOKEN_UNKNOWN, Value: string(l.current), Position: l.position - 1}
@@ -224,9 +309,18 @@ func (l *Lexer) NextToken() Token {
 		}
 	}
 
+	tok.Line, tok.Column = line, column
 	return tok
 }
 
+// noteAttributeValue remembers a format="markdown" attribute, which makes the
+// element a raw text element
+func (l *Lexer) noteAttributeValue(value string) {
+	if l.attrName == MARKDOWN_FORMAT_ATTRIBUTE && value == MARKDOWN_FORMAT {
+		l.rawFormat = true
+	}
+}
+
 // TokenTypeString returns a string representation of the token type
 func (t TokenType) String() string {
 	switch t {
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Link check codes
+const (
+	LINK_BROKEN  = "link/broken"  // a relative target is missing from the output
+	LINK_INVALID = "link/invalid" // an external URL is malformed
+)
+
+// linkAttributes maps the elements whose targets are checked to the
+// attribute holding the target: <anker href>, <bild quelle>, <verknüpfung href>
+var linkAttributes = map[string]string{
+	"a":    "href",
+	"img":  "src",
+	"link": "href",
+}
+
+// Link is a target a page refers to
+type Link struct {
+	URL       string
+	Element   string // as written in the source, for messages
+	Attribute string
+	Pos       Position
+	Inherited bool // from a layout or include rather than the page itself
+}
+
+// collectLinks returns the link and asset targets of a document transpiled
+// from filename
+func collectLinks(document *Document, filename string) []Link {
+	var links []Link
+	Inspect(document, func(node Node) bool {
+		element, ok := node.(*Element)
+		if !ok {
+			return true
+		}
+		name, checked := linkAttributes[element.TagName]
+		if !checked {
+			return true
+		}
+		for _, attr := range element.Attributes {
+			if attr.Name == name && strings.TrimSpace(attr.Value) != "" {
+				links = append(links, Link{
+					URL:       strings.TrimSpace(attr.Value),
+					Element:   element.SourceName,
+					Attribute: attr.SourceName,
+					Pos:       attr.Pos,
+					Inherited: attr.Pos.File != filename,
+				})
+			}
+		}
+		return true
+	})
+	return links
+}
+
+// checkLinks verifies the links of the built pages in a report against the
+// output directory and adds a diagnostic to the page for each broken one
+func checkLinks(report *BuildReport, outputDir string) {
+	for i := range report.Files {
+		file := &report.Files[i]
+		seen := map[string]bool{}
+		for _, link := range file.Links {
+			diagnostic, broken := checkLink(link, outputDir, file.Output)
+			if !broken || seen[diagnostic.String()] {
+				continue
+			}
+			// Links from layouts and includes are reported with the page that broke them
+			if link.Inherited {
+				diagnostic.Message += fmt.Sprintf(" (on %s)", filepath.ToSlash(file.Output))
+			}
+			seen[diagnostic.String()] = true
+			file.Diagnostics = append(file.Diagnostics, diagnostic)
+		}
+	}
+}
+
+// checkLink checks one link of the page written to page, relative to the
+// output directory. External URLs are only checked for their syntax.
+func checkLink(link Link, outputDir, page string) (Diagnostic, bool) {
+	label := fmt.Sprintf("<%s %s=%q>", link.Element, link.Attribute, link.URL)
+	target, err := url.Parse(link.URL)
+	if err != nil {
+		return Diagnostic{Severity: SEVERITY_ERROR, Code: LINK_INVALID, Message: fmt.Sprintf("%s is not a valid URL", label), Pos: link.Pos}, true
+	}
+
+	switch {
+	case target.Scheme == "http" || target.Scheme == "https" || (target.Scheme == "" && target.Host != ""):
+		if target.Host == "" || strings.ContainsAny(target.Host, " \t") {
+			return Diagnostic{Severity: SEVERITY_ERROR, Code: LINK_INVALID, Message: fmt.Sprintf("%s has no valid host", label), Pos: link.Pos}, true
+		}
+		return Diagnostic{}, false
+	case target.Scheme == "mailto" || target.Scheme == "tel":
+		if target.Opaque == "" {
+			return Diagnostic{Severity: SEVERITY_ERROR, Code: LINK_INVALID, Message: fmt.Sprintf("%s has no address", label), Pos: link.Pos}, true
+		}
+		return Diagnostic{}, false
+	case target.Scheme != "" || target.Path == "":
+		// Other schemes, and links to a fragment of the same page
+		return Diagnostic{}, false
+	}
+
+	// Absolute paths start at the output root, others next to the page
+	rel := path.Clean(strings.TrimPrefix(target.Path, "/"))
+	if !strings.HasPrefix(target.Path, "/") {
+		rel = path.Join(path.Dir(filepath.ToSlash(page)), target.Path)
+	}
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return Diagnostic{Severity: SEVERITY_ERROR, Code: LINK_BROKEN, Message: fmt.Sprintf("%s points outside the output", label), Pos: link.Pos}, true
+	}
+
+	resolved := filepath.Join(outputDir, filepath.FromSlash(rel))
+	info, err := os.Stat(resolved)
+	if err == nil && info.IsDir() {
+		_, err = os.Stat(filepath.Join(resolved, "index.html"))
+		rel = path.Join(rel, "index.html")
+	}
+	if err != nil {
+		return Diagnostic{Severity: SEVERITY_ERROR, Code: LINK_BROKEN, Message: fmt.Sprintf("%s points to %s, which is not in the output", label, "/"+rel), Pos: link.Pos}, true
+	}
+	return Diagnostic{}, false
+}
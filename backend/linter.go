@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LintConfig enables or disables lint rules by name; rules not listed keep
+// their default
+type LintConfig struct {
+	Rules map[string]bool `json:"rules"`
+}
+
+// lintReport records a finding of a rule
+type lintReport func(pos Position, format string, args ...interface{})
+
+// LintRule checks a document for one kind of problem
+type LintRule struct {
+	Name        string
+	Description string
+	Severity    Severity
+	run         func(l *Linter, doc *Document, report lintReport)
+}
+
+// lintRules are all available rules, in the order they run
+var lintRules = []LintRule{
+	{
+		Name:        "img-alt",
+		Description: "images need alternative text",
+		Severity:    SEVERITY_WARNING,
+		run: func(l *Linter, doc *Document, report lintReport) {
+			walkElements(doc, func(e *Element, ancestors []*Element) {
+				if _, exists := e.GetAttribute("alt"); e.TagName == "img" && !exists {
+					report(e.Pos, "<%s> has no %q attribute", e.SourceName, l.germanAttribute("alt"))
+				}
+			})
+		},
+	},
+	{
+		Name:        "heading-order",
+		Description: "heading levels must not be skipped",
+		Severity:    SEVERITY_WARNING,
+		run: func(l *Linter, doc *Document, report lintReport) {
+			var previous *Element
+			walkElements(doc, func(e *Element, ancestors []*Element) {
+				level := headingLevel(e.TagName)
+				if level == 0 {
+					return
+				}
+				if previous != nil && level > headingLevel(previous.TagName)+1 {
+					report(e.Pos, "<%s> skips a heading level after <%s>", e.SourceName, previous.SourceName)
+				}
+				previous = e
+			})
+		},
+	},
+	{
+		Name:        "empty-anchor",
+		Description: "links need text content",
+		Severity:    SEVERITY_WARNING,
+		run: func(l *Linter, doc *Document, report lintReport) {
+			walkElements(doc, func(e *Element, ancestors []*Element) {
+				if e.TagName == "a" && !hasAccessibleContent(e) {
+					report(e.Pos, "<%s> has no text content", e.SourceName)
+				}
+			})
+		},
+	},
+	{
+		Name:        "english-tag",
+		Description: "prefer the German name where the dictionary has one",
+		Severity:    SEVERITY_INFO,
+		run: func(l *Linter, doc *Document, report lintReport) {
+			walkElements(doc, func(e *Element, ancestors []*Element) {
+				if e.Kind != NAME_PASSTHROUGH {
+					return
+				}
+				if german, exists := l.dictionary.GermanTag(e.TagName); exists {
+					report(e.Pos, "English tag <%s> used, the German name is <%s>", e.SourceName, german)
+				}
+			})
+		},
+	},
+	{
+		Name:        "inline-event-handler",
+		Description: "event handlers should not be written inline",
+		Severity:    SEVERITY_WARNING,
+		run: func(l *Linter, doc *Document, report lintReport) {
+			walkElements(doc, func(e *Element, ancestors []*Element) {
+				for _, attr := range e.Attributes {
+					if strings.HasPrefix(strings.ToLower(attr.Name), "on") {
+						report(attr.Pos, "inline event handler %q on <%s>", attr.SourceName, e.SourceName)
+					}
+				}
+			})
+		},
+	},
+	{
+		Name:        "nested-paragraph",
+		Description: "paragraphs cannot contain paragraphs",
+		Severity:    SEVERITY_ERROR,
+		run: func(l *Linter, doc *Document, report lintReport) {
+			walkElements(doc, func(e *Element, ancestors []*Element) {
+				if e.TagName != "p" {
+					return
+				}
+				for _, ancestor := range ancestors {
+					if ancestor.TagName == "p" {
+						report(e.Pos, "<%s> is nested inside <%s>", e.SourceName, ancestor.SourceName)
+						return
+					}
+				}
+			})
+		},
+	},
+}
+
+// LintRules returns the available rules sorted by name
+func LintRules() []LintRule {
+	rules := append([]LintRule(nil), lintRules...)
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// Linter runs the enabled lint rules over documents
+type Linter struct {
+	rules      []LintRule
+	dictionary *Dictionary
+}
+
+// NewLinter creates a linter with the rules enabled by config
+func NewLinter(config LintConfig) (*Linter, error) {
+	for name := range config.Rules {
+		if !isLintRule(name) {
+			return nil, fmt.Errorf("unknown lint rule %q", name)
+		}
+	}
+
+	linter := &Linter{dictionary: NewDictionary()}
+	for _, rule := range lintRules {
+		if enabled, exists := config.Rules[rule.Name]; !exists || enabled {
+			linter.rules = append(linter.rules, rule)
+		}
+	}
+	return linter, nil
+}
+
+// SetDictionary replaces the dictionary used to parse sources and to name
+// elements in messages, so findings match what the transpiler sees
+func (l *Linter) SetDictionary(dictionary *Dictionary) {
+	l.dictionary = dictionary
+}
+
+// Check runs the enabled rules and returns their findings in source order
+func (l *Linter) Check(doc *Document) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, rule := range l.rules {
+		rule.run(l, doc, func(pos Position, format string, args ...interface{}) {
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: rule.Severity,
+				Code:     rule.Name,
+				Message:  fmt.Sprintf(format, args...),
+				Pos:      pos,
+			})
+		})
+	}
+	sortDiagnostics(diagnostics)
+	return diagnostics
+}
+
+// LintSource parses a German HTML source and lints it; a syntax error is
+// reported as the only diagnostic
+func (l *Linter) LintSource(filename, input string) []Diagnostic {
+	parser := NewParser(NewLexer(input), l.dictionary)
+	parser.SetFilename(filename)
+
+	document, err := parser.Parse()
+	if err != nil {
+		return []Diagnostic{DiagnosticFromError(err)}
+	}
+	return l.Check(document)
+}
+
+// germanAttribute returns the German spelling of an HTML attribute for messages
+func (l *Linter) germanAttribute(name string) string {
+	if german, exists := l.dictionary.GermanAttribute(name); exists {
+		return german
+	}
+	return name
+}
+
+func isLintRule(name string) bool {
+	for _, rule := range lintRules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// walkElements calls f for every element in document order together with its
+// enclosing elements, outermost first
+func walkElements(node Node, f func(e *Element, ancestors []*Element)) {
+	var ancestors []*Element
+	var visit func(Node)
+	visit = func(node Node) {
+		element, ok := node.(*Element)
+		if ok {
+			f(element, ancestors)
+			ancestors = append(ancestors, element)
+		}
+		for _, child := range childrenOf(node) {
+			visit(child)
+		}
+		if ok {
+			ancestors = ancestors[:len(ancestors)-1]
+		}
+	}
+	visit(node)
+}
+
+// headingLevel returns 1-6 for h1-h6 and 0 for other tags
+func headingLevel(tag string) int {
+	if len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6' {
+		return int(tag[1] - '0')
+	}
+	return 0
+}
+
+// hasAccessibleContent reports whether an element contains text or an image
+// with alternative text
+func hasAccessibleContent(e *Element) bool {
+	found := false
+	Inspect(e, func(node Node) bool {
+		switch n := node.(type) {
+		case *TextNode:
+			if strings.TrimSpace(n.Content) != "" {
+				found = true
+			}
+		case *Element:
+			if alt, _ := n.GetAttribute("alt"); n.TagName == "img" && strings.TrimSpace(alt) != "" {
+				found = true
+			}
+			if label, _ := n.GetAttribute("aria-label"); strings.TrimSpace(label) != "" {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
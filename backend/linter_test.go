@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinterUsesConfiguredDictionary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dict.json")
+	if err := os.WriteFile(path, []byte(`{"tags": {"markierung": "mark"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{Dictionary: path}
+	dictionary, err := config.LoadDictionary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	linter, err := NewLinter(config.Lint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linter.SetDictionary(dictionary)
+
+	diagnostics := linter.LintSource("", "<mark>x</mark>")
+	if len(diagnostics) != 1 || diagnostics[0].Code != "english-tag" {
+		t.Fatalf("got %v, want an english-tag finding naming <markierung>", diagnostics)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Live transpiling over a WebSocket
+const (
+	LIVE_TRANSPILE_PATH = "/ws"
+	LIVE_THROTTLE       = 200 * time.Millisecond // at most one transpile per connection in this time
+	LIVE_PING_INTERVAL  = 30 * time.Second
+	LIVE_IDLE_TIMEOUT   = 2 * LIVE_PING_INTERVAL // without any frame from the client
+	LIVE_MAX_MESSAGE    = 2 * MAX_INPUT_SIZE     // a full document, JSON-escaped
+)
+
+// Message types of the live protocol
+const (
+	liveOpen   = "open"   // client: the whole document and the options
+	liveChange = "change" // client: edits to the document
+	liveResult = "result" // server: the transpiled document
+	liveError  = "error"  // server: a message that could not be applied
+)
+
+// liveMessage is a message from the client. Open carries the document in
+// Content together with the options of a TranspileRequest; change carries
+// Changes, applied in order. Version is echoed in the result.
+type liveMessage struct {
+	Type    string     `json:"type"`
+	Version int        `json:"version"`
+	Changes []liveEdit `json:"changes,omitempty"`
+	TranspileRequest
+}
+
+// liveEdit replaces the text from Start up to End with Text. Offsets count
+// UTF-16 code units, like JavaScript string indexes.
+type liveEdit struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text"`
+}
+
+// liveResponse is a message to the client
+type liveResponse struct {
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+	TranspileResponse
+}
+
+// liveSession is the document of one connection. Messages update it right
+// away; the transpiler catches up at most once per LIVE_THROTTLE with the
+// latest version, so fast typing costs one transpile per interval.
+type liveSession struct {
+	conn          *wsConn
+	newTranspiler func(TranspileRequest) *Transpiler
+
+	mutex   sync.Mutex
+	request TranspileRequest // options, and Content as the current document
+	version int
+	opened  bool
+
+	dirty chan struct{} // signalled when the document changed
+	done  chan struct{}
+}
+
+// serveLiveTranspile runs the live protocol on a WebSocket until the client
+// goes away
+func serveLiveTranspile(w http.ResponseWriter, r *http.Request, newTranspiler func(TranspileRequest) *Transpiler) {
+	conn, err := upgradeWebSocket(w, r, LIVE_MAX_MESSAGE)
+	if err != nil {
+		return
+	}
+	session := &liveSession{
+		conn:          conn,
+		newTranspiler: newTranspiler,
+		dirty:         make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	go session.transpileLoop()
+	defer close(session.done)
+
+	for {
+		opcode, data, err := conn.ReadMessage(LIVE_IDLE_TIMEOUT)
+		if err != nil {
+			var closeErr *wsCloseError
+			var netErr net.Error
+			switch {
+			case errors.As(err, &closeErr):
+			case errors.As(err, &netErr) && netErr.Timeout():
+				conn.Close(WS_CLOSE_GOING_AWAY, "idle")
+			default:
+				conn.Close(WS_CLOSE_PROTOCOL, "")
+			}
+			return
+		}
+		if opcode != wsText {
+			conn.Close(WS_CLOSE_UNSUPPORTED, "messages must be JSON text")
+			return
+		}
+		if err := session.handle(data); err != nil {
+			session.send(liveResponse{Type: liveError, TranspileResponse: TranspileResponse{Error: err.Error()}})
+		}
+	}
+}
+
+// handle applies one client message to the document
+func (s *liveSession) handle(data []byte) error {
+	var message liveMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return errors.New("Invalid JSON")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch message.Type {
+	case liveOpen:
+		if err := validateInput(message.Content); err != nil {
+			return err
+		}
+		s.request = message.TranspileRequest
+		s.opened = true
+	case liveChange:
+		if !s.opened {
+			return errors.New("send an open message with the document first")
+		}
+		content := s.request.Content
+		for _, change := range message.Changes {
+			var err error
+			if content, err = applyLiveChange(content, change); err != nil {
+				return fmt.Errorf("%v; send the document again", err)
+			}
+		}
+		if err := validateInput(content); err != nil {
+			return err
+		}
+		s.request.Content = content
+	default:
+		return fmt.Errorf("unknown message type %q", message.Type)
+	}
+	s.version = message.Version
+
+	select {
+	case s.dirty <- struct{}{}:
+	default: // a transpile is already pending and will see this version
+	}
+	return nil
+}
+
+// transpileLoop transpiles the latest version whenever the document changed,
+// waiting LIVE_THROTTLE between runs, and keeps the connection alive
+func (s *liveSession) transpileLoop() {
+	ping := time.NewTicker(LIVE_PING_INTERVAL)
+	defer ping.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ping.C:
+			s.conn.Ping()
+		case <-s.dirty:
+			started := time.Now()
+			s.mutex.Lock()
+			request, version := s.request, s.version
+			select {
+			case <-s.dirty: // signalled while we waited for the lock; this is that version
+			default:
+			}
+			s.mutex.Unlock()
+
+			response, ok := s.transpile(request, version)
+			s.send(response)
+			if !ok {
+				s.conn.Close(WS_CLOSE_INTERNAL, "internal error")
+				return
+			}
+			select {
+			case <-s.done:
+				return
+			case <-time.After(LIVE_THROTTLE - time.Since(started)):
+			}
+		}
+	}
+}
+
+// transpile transpiles one version of the document. A panic in the pipeline
+// becomes an error result with ok false, and the caller ends the session
+// instead of the whole server going down.
+func (s *liveSession) transpile(request TranspileRequest, version int) (response liveResponse, ok bool) {
+	response = liveResponse{Type: liveResult, Version: version}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("live transpile: panic: %v\n%s", r, debug.Stack())
+			response.Error = "internal error while transpiling"
+			ok = false
+		}
+	}()
+
+	result, err := s.newTranspiler(request).TranspileDocument(request.Content)
+	if err != nil {
+		response.Error = err.Error()
+		response.Diagnostics = []Diagnostic{DiagnosticFromError(err)}
+		return response, true
+	}
+	response.Result, response.Diagnostics, response.FrontMatter = result.HTML, result.Diagnostics, result.FrontMatter
+	return response, true
+}
+
+// send writes a message to the client
+func (s *liveSession) send(response liveResponse) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("live transpile: %v", err)
+		return
+	}
+	s.conn.WriteText(data)
+}
+
+// applyLiveChange applies a change to content
+func applyLiveChange(content string, change liveEdit) (string, error) {
+	start, ok := utf16ByteOffset(content, change.Start)
+	end, endOK := utf16ByteOffset(content, change.End)
+	if !ok || !endOK || start > end {
+		return "", fmt.Errorf("change %d-%d is outside the document", change.Start, change.End)
+	}
+	return content[:start] + change.Text + content[end:], nil
+}
+
+// utf16ByteOffset converts an offset in UTF-16 code units into a byte offset
+// in s; offsets inside a surrogate pair are rounded down to the character
+func utf16ByteOffset(s string, offset int) (int, bool) {
+	if offset < 0 {
+		return 0, false
+	}
+	units := 0
+	for i, r := range s {
+		width := 1
+		if r >= 0x10000 {
+			width = 2
+		}
+		if units+width > offset {
+			return i, true
+		}
+		units += width
+	}
+	return len(s), units == offset
+}
+
+// sameOrigin reports whether a browser origin is the server itself, as for
+// the frontend served from ./static
+func sameOrigin(r *http.Request, origin string) bool {
+	parsed, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(parsed.Host, r.Host)
+}
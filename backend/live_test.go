@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newLiveServer serves the live protocol with newTranspiler
+func newLiveServer(t *testing.T, newTranspiler func(TranspileRequest) *Transpiler) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveLiveTranspile(w, r, newTranspiler)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// sendJSON sends message as a text frame
+func (c *wsTestClient) sendJSON(message any) {
+	c.t.Helper()
+	data, err := json.Marshal(message)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.writeFrame(true, wsText, data, true)
+}
+
+// readResponse reads the next live message, skipping pings
+func (c *wsTestClient) readResponse() liveResponse {
+	c.t.Helper()
+	for {
+		opcode, payload := c.readFrame()
+		if opcode == wsPing {
+			continue
+		}
+		var response liveResponse
+		if opcode != wsText || json.Unmarshal(payload, &response) != nil {
+			c.t.Fatalf("got opcode %d payload %q, want a live message", opcode, payload)
+		}
+		return response
+	}
+}
+
+func TestLiveTranspileCoalescesChanges(t *testing.T) {
+	var transpiles atomic.Int32
+	server := newLiveServer(t, func(TranspileRequest) *Transpiler {
+		transpiles.Add(1)
+		return NewTranspiler()
+	})
+	client := dialWebSocket(t, server)
+
+	client.sendJSON(map[string]any{"type": liveOpen, "version": 1, "content": "<absatz></absatz>"})
+	for version := 2; version <= 20; version++ {
+		client.sendJSON(map[string]any{
+			"type":    liveChange,
+			"version": version,
+			"changes": []liveEdit{{Start: 8, End: 8, Text: "x"}},
+		})
+	}
+
+	// The first message is transpiled right away, the rest once the
+	// throttle has passed
+	var last liveResponse
+	for last.Version != 20 {
+		last = client.readResponse()
+		if last.Type != liveResult || last.Error != "" {
+			t.Fatalf("got %+v", last)
+		}
+	}
+	if want := "<p>" + strings.Repeat("x", 19) + "</p>\n"; last.Result != want {
+		t.Errorf("got %q, want %q", last.Result, want)
+	}
+	if n := transpiles.Load(); n > 3 {
+		t.Errorf("transpiled %d times for 20 quick messages", n)
+	}
+
+	// Nothing more is pending
+	client.conn.SetReadDeadline(time.Now().Add(2 * LIVE_THROTTLE))
+	if _, err := client.reader.ReadByte(); err == nil {
+		t.Error("got another message after the latest version")
+	}
+}
+
+func TestLiveTranspileReportsBadMessages(t *testing.T) {
+	client := dialWebSocket(t, newLiveServer(t, func(TranspileRequest) *Transpiler { return NewTranspiler() }))
+
+	client.sendJSON(map[string]any{"type": liveChange, "version": 1})
+	if response := client.readResponse(); response.Type != liveError {
+		t.Fatalf("change before open: got %+v", response)
+	}
+	client.sendJSON(map[string]any{"type": liveOpen, "version": 1, "content": "ab"})
+	client.sendJSON(map[string]any{"type": liveChange, "version": 2, "changes": []liveEdit{{Start: 1, End: 5}}})
+	for {
+		response := client.readResponse()
+		if response.Type == liveError {
+			break
+		}
+		if response.Version != 1 {
+			t.Fatalf("got %+v, want the result of the open and an error", response)
+		}
+	}
+}
+
+func TestLiveTranspileRecoversFromPanics(t *testing.T) {
+	server := newLiveServer(t, func(TranspileRequest) *Transpiler {
+		transpiler := NewTranspiler()
+		transpiler.AddTransform(func(*Document) error { panic("kaputt") })
+		return transpiler
+	})
+
+	client := dialWebSocket(t, server)
+	client.sendJSON(map[string]any{"type": liveOpen, "version": 1, "content": "<absatz>x</absatz>"})
+	if response := client.readResponse(); response.Type != liveResult || response.Version != 1 || response.Error == "" {
+		t.Fatalf("got %+v, want an error result", response)
+	}
+	client.expectClose(WS_CLOSE_INTERNAL)
+
+	// The server keeps serving other connections
+	other := dialWebSocket(t, server)
+	other.sendJSON(map[string]any{"type": liveOpen, "version": 1, "content": "x"})
+	if response := other.readResponse(); response.Error == "" {
+		t.Fatalf("got %+v, want an error result", response)
+	}
+}
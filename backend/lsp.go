@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// JSON-RPC error codes used by the language server
+const (
+	LSP_PARSE_ERROR      = -32700
+	LSP_METHOD_NOT_FOUND = -32601
+	LSP_INVALID_PARAMS   = -32602
+	LSP_REQUEST_FAILED   = -32803
+)
+
+// LSP enumerations the server uses
+const (
+	lspSyncIncremental   = 2
+	lspCompletionKeyword = 14
+	lspCompletionField   = 5
+	lspMarkdown          = "markdown"
+)
+
+// lspMessage is a JSON-RPC request, notification or response
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// lspPosition is a 0-based line and a character offset in UTF-16 code units
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspTextDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+// lspPositionParams are the parameters of requests about a place in a document
+type lspPositionParams struct {
+	TextDocument lspTextDocument `json:"textDocument"`
+	Position     lspPosition     `json:"position"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspCompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+// lspServer is a language server for German HTML sources, speaking JSON-RPC
+// with Content-Length framed messages
+type lspServer struct {
+	in         *bufio.Reader
+	out        io.Writer
+	linter     *Linter
+	dictionary *Dictionary
+	documents  map[string]*IncrementalParser // open documents by URI
+	shutdown   bool
+}
+
+// newLSPServer creates a server reading requests from in and writing to out
+func newLSPServer(in io.Reader, out io.Writer, linter *Linter, dictionary *Dictionary) *lspServer {
+	return &lspServer{
+		in:         bufio.NewReader(in),
+		out:        out,
+		linter:     linter,
+		dictionary: dictionary,
+		documents:  map[string]*IncrementalParser{},
+	}
+}
+
+// run answers messages until the client sends exit or closes the input. It
+// returns an error when the client exits without asking for a shutdown first.
+func (s *lspServer) run() error {
+	for {
+		message, err := s.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) {
+				// The id could not be read, and JSON-RPC wants it as null then
+				null := json.RawMessage("null")
+				s.write(lspMessage{ID: &null, Error: &lspError{Code: LSP_PARSE_ERROR, Message: err.Error()}})
+				continue
+			}
+			return err
+		}
+		if message.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		}
+		s.handle(message)
+	}
+}
+
+// read reads one message
+func (s *lspServer) read() (*lspMessage, error) {
+	headers, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", headers.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+
+	var message lspMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// write sends one message
+func (s *lspServer) write(message lspMessage) {
+	message.JSONRPC = "2.0"
+	body, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// handle answers a request or acts on a notification
+func (s *lspServer) handle(message *lspMessage) {
+	var result interface{}
+	var err *lspError
+	switch message.Method {
+	case "initialize":
+		result = map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           lspSyncIncremental,
+				"completionProvider":         map[string]interface{}{"triggerCharacters": []string{"<", "/", " "}},
+				"hoverProvider":              true,
+				"definitionProvider":         true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "doner", "version": version},
+		}
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument lspTextDocument `json:"textDocument"`
+		}
+		if json.Unmarshal(message.Params, &params) == nil {
+			uri := params.TextDocument.URI
+			s.documents[uri] = NewIncrementalParser(uriPath(uri), params.TextDocument.Text, s.dictionary)
+			s.publishDiagnostics(params.TextDocument.URI)
+		}
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument   lspTextDocument `json:"textDocument"`
+			ContentChanges []struct {
+				Range *lspRange `json:"range"`
+				Text  string    `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if json.Unmarshal(message.Params, &params) != nil {
+			break
+		}
+		document, open := s.documents[params.TextDocument.URI]
+		if !open {
+			break
+		}
+		// Changes with a range are reparsed incrementally, others replace the text
+		for _, change := range params.ContentChanges {
+			if change.Range == nil {
+				document.Reset(change.Text)
+				continue
+			}
+			source := document.Source()
+			document.Apply(TextEdit{Start: runeOffset(source, change.Range.Start), End: runeOffset(source, change.Range.End), Text: change.Text})
+		}
+		s.publishDiagnostics(params.TextDocument.URI)
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument lspTextDocument `json:"textDocument"`
+		}
+		if json.Unmarshal(message.Params, &params) == nil {
+			delete(s.documents, params.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": params.TextDocument.URI, "diagnostics": []lspDiagnostic{}})
+		}
+	case "textDocument/completion":
+		result, err = s.withPosition(message, s.completion)
+	case "textDocument/hover":
+		result, err = s.withPosition(message, s.hover)
+	case "textDocument/definition":
+		result, err = s.withPosition(message, s.matchingTag)
+	case "textDocument/formatting":
+		result, err = s.format(message)
+	default:
+		if message.ID != nil {
+			err = &lspError{Code: LSP_METHOD_NOT_FOUND, Message: "method not supported: " + message.Method}
+		}
+	}
+
+	// Notifications get no answer
+	if message.ID == nil {
+		return
+	}
+	if err != nil {
+		s.write(lspMessage{ID: message.ID, Error: err})
+		return
+	}
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+	s.write(lspMessage{ID: message.ID, Result: result})
+}
+
+// notify sends a notification to the client
+func (s *lspServer) notify(method string, params interface{}) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+	s.write(lspMessage{Method: method, Params: data})
+}
+
+// withPosition decodes the parameters of a request about a place in an open
+// document and passes the document and the rune offset to answer
+func (s *lspServer) withPosition(message *lspMessage, answer func(uri, text string, offset int) interface{}) (interface{}, *lspError) {
+	var params lspPositionParams
+	if err := json.Unmarshal(message.Params, &params); err != nil {
+		return nil, &lspError{Code: LSP_INVALID_PARAMS, Message: err.Error()}
+	}
+	document, open := s.documents[params.TextDocument.URI]
+	if !open {
+		return nil, &lspError{Code: LSP_REQUEST_FAILED, Message: "document is not open: " + params.TextDocument.URI}
+	}
+	text := document.Source()
+	return answer(params.TextDocument.URI, text, runeOffset(text, params.Position)), nil
+}
+
+// publishDiagnostics lints the parsed document and sends the findings
+func (s *lspServer) publishDiagnostics(uri string) {
+	text := s.documents[uri].Source()
+	var findings []Diagnostic
+	if document, err := s.documents[uri].Document(); err != nil {
+		findings = []Diagnostic{DiagnosticFromError(err)}
+	} else {
+		findings = s.linter.Check(document)
+	}
+
+	diagnostics := []lspDiagnostic{}
+	for _, d := range findings {
+		start := lspPositionOf(text, d.Pos)
+		end := start
+		end.Character += utf16Length(wordAt(text, runeOffset(text, start)))
+		if end == start {
+			end.Character++
+		}
+		diagnostics = append(diagnostics, lspDiagnostic{
+			Range:    lspRange{Start: start, End: end},
+			Severity: int(d.Severity) + 1, // error, warning, information
+			Code:     d.Code,
+			Source:   "doner",
+			Message:  d.Message,
+		})
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": diagnostics})
+}
+
+// Patterns for the text of a tag typed up to the cursor: the start of its
+// name, or the name and the attributes so far
+var (
+	tagNameContextPattern   = regexp.MustCompile(`^/?[\p{L}\p{N}_-]*$`)
+	attributeContextPattern = regexp.MustCompile(`^[\p{L}\p{N}_-]+(?:\s+[\p{L}\p{N}_-]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'>]+))?)*\s+[\p{L}\p{N}_-]*$`)
+)
+
+// completion offers German tag names after < and attribute names inside a tag
+func (s *lspServer) completion(uri, text string, offset int) interface{} {
+	before := string([]rune(text)[:offset])
+	open := strings.LastIndexByte(before, '<')
+	if open < 0 || strings.LastIndexByte(before, '>') > open {
+		return []lspCompletionItem{}
+	}
+	tag := before[open+1:]
+
+	var items []lspCompletionItem
+	switch {
+	case tagNameContextPattern.MatchString(tag):
+		for german, html := range s.dictionary.tags {
+			items = append(items, lspCompletionItem{Label: german, Kind: lspCompletionKeyword, Detail: "<" + html + ">"})
+		}
+		for _, directive := range directiveTags {
+			items = append(items, lspCompletionItem{Label: directive, Kind: lspCompletionKeyword, Detail: "doner"})
+		}
+	case attributeContextPattern.MatchString(tag):
+		for german, html := range s.dictionary.attributes {
+			items = append(items, lspCompletionItem{Label: german, Kind: lspCompletionField, Detail: html})
+		}
+	default:
+		return []lspCompletionItem{}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+// hover shows the HTML equivalent of the tag or attribute name under the cursor
+func (s *lspServer) hover(uri, text string, offset int) interface{} {
+	runes := []rune(text)
+	start, end := wordBounds(runes, offset)
+	if start == end {
+		return nil
+	}
+	name := string(runes[start:end])
+
+	before := string(runes[:start])
+	open := strings.LastIndexByte(before, '<')
+	if open < 0 || strings.LastIndexByte(before, '>') > open {
+		return nil
+	}
+	var contents string
+	if between := strings.TrimPrefix(before[open+1:], "/"); between == "" {
+		html, kind := s.dictionary.LookupTag(name)
+		switch {
+		case isDirective(name) || name == MARKDOWN_TAG:
+			contents = fmt.Sprintf("`<%s>` is a doner directive, handled while transpiling", name)
+		case kind == NAME_UNKNOWN:
+			return nil
+		default:
+			contents = fmt.Sprintf("`<%s>` → `<%s>` (%s)", name, html, kind)
+		}
+	} else {
+		html, kind := s.dictionary.LookupAttribute(name)
+		if kind == NAME_UNKNOWN || strings.Count(before[open:], `"`)%2 == 1 {
+			return nil
+		}
+		contents = fmt.Sprintf("`%s` → `%s` (%s)", name, html, kind)
+	}
+
+	return map[string]interface{}{
+		"contents": map[string]string{"kind": lspMarkdown, "value": contents},
+		"range":    lspRange{Start: lspPositionAt(text, start), End: lspPositionAt(text, end)},
+	}
+}
+
+// matchingTag finds the closing tag for an opening tag name under the
+// cursor, or the opening tag for a closing one
+func (s *lspServer) matchingTag(uri, text string, offset int) interface{} {
+	type tagName struct {
+		token   Token
+		closing bool
+	}
+	var names []tagName
+	lexer := NewLexer(text)
+	previous := TOKEN_UNKNOWN
+	pairs := map[int]int{}
+	var stack []int
+	for tok := lexer.NextToken(); tok.Type != TOKEN_EOF; tok = lexer.NextToken() {
+		switch {
+		case tok.Type == TOKEN_TAG_NAME && previous == TOKEN_TAG_OPEN:
+			stack = append(stack, len(names))
+			names = append(names, tagName{token: tok})
+		case tok.Type == TOKEN_TAG_NAME && previous == TOKEN_TAG_END:
+			// Close the innermost open tag of that name, as far as it nests
+			for i := len(stack) - 1; i >= 0; i-- {
+				if names[stack[i]].token.Value == tok.Value {
+					pairs[stack[i]] = len(names)
+					pairs[len(names)] = stack[i]
+					stack = stack[:i]
+					break
+				}
+			}
+			names = append(names, tagName{token: tok, closing: true})
+		case tok.Type == TOKEN_TAG_CLOSE_SLASH && len(stack) > 0:
+			stack = stack[:len(stack)-1]
+		}
+		previous = tok.Type
+	}
+
+	for i, name := range names {
+		start := name.token.Position
+		if offset < start || offset > start+len([]rune(name.token.Value)) {
+			continue
+		}
+		other, matched := pairs[i]
+		if !matched {
+			return nil
+		}
+		target := names[other].token
+		return lspLocation{URI: uri, Range: lspRange{
+			Start: lspPositionAt(text, target.Position),
+			End:   lspPositionAt(text, target.Position+len([]rune(target.Value))),
+		}}
+	}
+	return nil
+}
+
+// format formats a whole document with the formatter
+func (s *lspServer) format(message *lspMessage) (interface{}, *lspError) {
+	var params struct {
+		TextDocument lspTextDocument `json:"textDocument"`
+	}
+	if err := json.Unmarshal(message.Params, &params); err != nil {
+		return nil, &lspError{Code: LSP_INVALID_PARAMS, Message: err.Error()}
+	}
+	document, open := s.documents[params.TextDocument.URI]
+	if !open {
+		return nil, &lspError{Code: LSP_REQUEST_FAILED, Message: "document is not open: " + params.TextDocument.URI}
+	}
+	text := document.Source()
+
+	formatted, err := FormatSource(text, s.dictionary)
+	if err != nil {
+		return nil, &lspError{Code: LSP_REQUEST_FAILED, Message: err.Error()}
+	}
+	if formatted == text {
+		return []lspTextEdit{}, nil
+	}
+	whole := lspRange{End: lspPositionAt(text, len([]rune(text)))}
+	return []lspTextEdit{{Range: whole, NewText: formatted}}, nil
+}
+
+// uriPath turns a file URI into a path for diagnostics
+func uriPath(uri string) string {
+	if parsed, err := url.Parse(uri); err == nil && parsed.Scheme == "file" {
+		return parsed.Path
+	}
+	return uri
+}
+
+// runeOffset converts an LSP position into a rune offset in text
+func runeOffset(text string, pos lspPosition) int {
+	offset, line, character := 0, 0, 0
+	for _, r := range text {
+		if line == pos.Line && (character >= pos.Character || r == '\n') {
+			return offset
+		}
+		if r == '\n' {
+			line++
+			character = 0
+		} else if r >= 0x10000 {
+			character += 2
+		} else {
+			character++
+		}
+		offset++
+	}
+	return offset
+}
+
+// lspPositionAt converts a rune offset in text into an LSP position
+func lspPositionAt(text string, offset int) lspPosition {
+	var pos lspPosition
+	for i, r := range []rune(text) {
+		if i >= offset {
+			break
+		}
+		switch {
+		case r == '\n':
+			pos.Line++
+			pos.Character = 0
+		case r >= 0x10000:
+			pos.Character += 2
+		default:
+			pos.Character++
+		}
+	}
+	return pos
+}
+
+// lspPositionOf converts a source position into an LSP position
+func lspPositionOf(text string, pos Position) lspPosition {
+	if !pos.IsValid() {
+		return lspPosition{}
+	}
+	lines := strings.Split(text, "\n")
+	if pos.Line > len(lines) {
+		return lspPositionAt(text, len([]rune(text)))
+	}
+	line := []rune(lines[pos.Line-1])
+	column := min(max(pos.Column-1, 0), len(line))
+	return lspPosition{Line: pos.Line - 1, Character: utf16Length(string(line[:column]))}
+}
+
+// wordAt returns the tag or attribute name starting at a rune offset
+func wordAt(text string, offset int) string {
+	runes := []rune(text)
+	_, end := wordBounds(runes, offset)
+	if end <= offset {
+		return ""
+	}
+	return string(runes[offset:end])
+}
+
+// wordBounds returns the start and end of the name around a rune offset
+func wordBounds(runes []rune, offset int) (int, int) {
+	isName := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+	}
+	start, end := offset, offset
+	for start > 0 && isName(runes[start-1]) {
+		start--
+	}
+	for end < len(runes) && isName(runes[end]) {
+		end++
+	}
+	return start, end
+}
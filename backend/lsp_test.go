@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLSPParseErrorHasNullID(t *testing.T) {
+	body := `{"jsonrpc": "2.0", "id": 1, "method": `
+	in := strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body))
+	var out bytes.Buffer
+	linter, err := NewLinter(LintConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLSPServer(in, &out, linter, NewDictionary()).run()
+
+	if !strings.Contains(out.String(), `"id":null`) || !strings.Contains(out.String(), `"code":-32700`) {
+		t.Errorf("got %q, want a parse error with a null id", out.String())
+	}
+}
@@ -14,11 +14,17 @@ import (
 
 type TranspileRequest struct {
 	Content string `json:"content"`
+	Lint    bool   `json:"lint,omitempty"` // also run the lint rules enabled in the config
+	A11y    bool   `json:"a11y,omitempty"` // also run the accessibility checks
+
+	Variables Variables `json:"variables,omitempty"` // values for {{ name }} placeholders
 }
 
 type TranspileResponse struct {
-	Result string `json:"result"`
-	Error  string `json:"error,omitempty"`
+	Result      string       `json:"result"`
+	Error       string       `json:"error,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	FrontMatter Variables    `json:"frontMatter,omitempty"`
 }
 
 // Rate limiting structures
@@ -87,44 +93,7 @@ func getClientIP(r *http.Request) string {
 }
 
 func main() {
-	// Check if running as CLI (if arguments provided)
-	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
-		runCLI()
-		return
-	}
-
-	// Run as web server
-	runServer()
-}
-
-func runCLI() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: deutsch-html-transpiler <input.dhtml>")
-		fmt.Println("Example: deutsch-html-transpiler beispiel.dhtml")
-		os.Exit(1)
-	}
-
-	inputFile := os.Args[1]
-	
-	// Read the German HTML file
-	content, err := os.ReadFile(inputFile)
-	if err != nil {
-		fmt.Printf("Error reading file: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Create transpiler instance
-	transpiler := NewTranspiler()
-	
-	// Transpile German HTML to standard HTML
-	result, err := transpiler.Transpile(string(content))
-	if err != nil {
-		fmt.Printf("Error transpiling: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Output the result
-	fmt.Println(result)
+	os.Exit(runCLI(os.Args[1:]))
 }
 
 // Security validation function - now just validates basic limits, doesn't block content
@@ -139,6 +108,41 @@ func validateInput(content string) error {
 	return nil
 }
 
+// allowedOrigins are the frontends that may call the API from a browser
+var allowedOrigins = []string{
+	"http://localhost:5173",   // Vite dev server
+	"http://localhost:3000",   // Alternative dev port
+	"https://doner-html-transpiler.onrender.com", // Production domain
+}
+
+// isAllowedOrigin reports whether origin is one of the allowed frontends
+func isAllowedOrigin(origin string) bool {
+	for _, allowed := range allowedOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// requestTranspiler derives a transpiler for an API request from the one
+// loaded at startup: includes only below the configured root, the request's
+// variables, and the checks it asks for
+func requestTranspiler(base *Transpiler, config *Config, linter *Linter, req TranspileRequest) *Transpiler {
+	transpiler := base.clone()
+	if config.IncludeRoot == "" {
+		transpiler.DisableIncludes()
+	}
+	transpiler.AddVariables(req.Variables)
+	if req.Lint {
+		transpiler.AddCheck(linter.Check)
+	}
+	if req.A11y {
+		transpiler.AddCheck(CheckAccessibility)
+	}
+	return transpiler
+}
+
 // Add security headers
 func addSecurityHeaders(w http.ResponseWriter) {
 	w.Header().Set("X-Content-Type-Options", "nosniff")
@@ -148,11 +152,21 @@ func addSecurityHeaders(w http.ResponseWriter) {
 	w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
 }
 
-func runServer() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+// runServer starts the API server. With a site directory it also serves the
+// sources in it as pages and reloads open pages when files change.
+func runServer(port string, config *Config, siteDir string) {
+	// Load the dictionary, data and components once; this also fails fast on
+	// unknown passes or broken files
+	baseTranspiler, err := config.NewTranspiler()
+	if err != nil {
+		log.Fatal(err)
 	}
+	siteTranspiler := baseTranspiler.clone()
+	linter, err := NewLinter(config.Lint)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	linter.SetDictionary(baseTranspiler.Dictionary())
 
 	// Initialize rate limiter: 100 requests per minute per IP
 	rateLimiter := NewRateLimiter(100, time.Minute)
@@ -160,22 +174,7 @@ func runServer() {
 	// CORS function
 	addCORSHeaders := func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
-		allowedOrigins := []string{
-			"http://localhost:5173",   // Vite dev server
-			"http://localhost:3000",   // Alternative dev port
-			"https://doner-html-transpiler.onrender.com", // Production domain
-		}
-		
-		// Check if origin is allowed
-		originAllowed := false
-		for _, allowed := range allowedOrigins {
-			if origin == allowed {
-				originAllowed = true
-				break
-			}
-		}
-		
-		if originAllowed || origin == "" { // Allow empty origin for same-origin requests
+		if isAllowedOrigin(origin) || origin == "" { // Allow empty origin for same-origin requests
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
@@ -242,13 +241,16 @@ func runServer() {
 		}
 
 		// Create transpiler instance
-		transpiler := NewTranspiler()
+		transpiler := requestTranspiler(baseTranspiler, config, linter, req)
 		
 		// Transpile German HTML to standard HTML
-		result, err := transpiler.Transpile(req.Content)
+		result, err := transpiler.TranspileDocument(req.Content)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(TranspileResponse{Error: err.Error()})
+			json.NewEncoder(w).Encode(TranspileResponse{
+				Error:       err.Error(),
+				Diagnostics: []Diagnostic{DiagnosticFromError(err)},
+			})
 			return
 		}
 
@@ -256,6 +258,70 @@ func runServer() {
 		// The input validation already handles dangerous content
 		// Just ensure clean output without double-encoding issues
 
+		json.NewEncoder(w).Encode(TranspileResponse{Result: result.HTML, Diagnostics: result.Diagnostics, FrontMatter: result.FrontMatter})
+	})
+
+	// Live transpile endpoint - a WebSocket for editors; the connection counts
+	// once against the rate limit and is throttled on its own
+	http.HandleFunc(LIVE_TRANSPILE_PATH, func(w http.ResponseWriter, r *http.Request) {
+		if !rateLimiter.Allow(getClientIP(r)) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && !isAllowedOrigin(origin) && !sameOrigin(r, origin) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		serveLiveTranspile(w, r, func(req TranspileRequest) *Transpiler {
+			return requestTranspiler(baseTranspiler, config, linter, req)
+		})
+	})
+
+	// Format endpoint - normalises German HTML without translating it
+	http.HandleFunc("/format", func(w http.ResponseWriter, r *http.Request) {
+		// Rate limiting check
+		clientIP := getClientIP(r)
+		if !rateLimiter.Allow(clientIP) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(TranspileResponse{Error: "Rate limit exceeded. Please try again later."})
+			return
+		}
+		
+		addSecurityHeaders(w)
+		addCORSHeaders(w, r)
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(TranspileResponse{Error: "Method not allowed"})
+			return
+		}
+
+		var req TranspileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(TranspileResponse{Error: "Invalid JSON"})
+			return
+		}
+
+		if err := validateInput(req.Content); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(TranspileResponse{Error: err.Error()})
+			return
+		}
+
+		result, err := FormatSource(req.Content, baseTranspiler.Dictionary())
+		if err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(TranspileResponse{Error: err.Error()})
+			return
+		}
+
 		json.NewEncoder(w).Encode(TranspileResponse{Result: result})
 	})
 
@@ -275,10 +341,9 @@ func runServer() {
 			return
 		}
 
-		transpiler := NewTranspiler()
 		response := map[string]interface{}{
-			"tags":       transpiler.GetSupportedTags(),
-			"attributes": transpiler.GetSupportedAttributes(),
+			"tags":       baseTranspiler.GetSupportedTags(),
+			"attributes": baseTranspiler.GetSupportedAttributes(),
 		}
 
 		json.NewEncoder(w).Encode(response)
@@ -286,7 +351,16 @@ func runServer() {
 
 	// Serve static files in production
 	staticDir := "./static"
-	if _, err := os.Stat(staticDir); err == nil {
+	if siteDir != "" {
+		// Development site - transpile sources on request and live-reload pages
+		if config.IncludeRoot == "" {
+			siteTranspiler.SetIncludeRoot(siteDir)
+		}
+		site := newSiteServer(siteDir, siteTranspiler)
+		go site.watch(DEFAULT_WATCH_INTERVAL, nil)
+		http.HandleFunc(LIVE_RELOAD_PATH, site.serveLiveReload)
+		http.Handle("/", site)
+	} else if _, err := os.Stat(staticDir); err == nil {
 		// Serve static assets
 		fs := http.FileServer(http.Dir(staticDir))
 		http.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir(staticDir+"/assets"))))
@@ -305,6 +379,7 @@ func runServer() {
 			if r.URL.Path == "/" || (!strings.HasPrefix(r.URL.Path, "/api/") && 
 				!strings.HasPrefix(r.URL.Path, "/health") && 
 				!strings.HasPrefix(r.URL.Path, "/transpile") && 
+				!strings.HasPrefix(r.URL.Path, "/format") && 
 				!strings.HasPrefix(r.URL.Path, "/dictionary")) {
 				http.ServeFile(w, r, staticDir+"/index.html")
 			} else {
@@ -337,6 +412,8 @@ func runServer() {
         <li><a href="/health">GET /health</a> - Health check</li>
         <li><a href="/dictionary">GET /dictionary</a> - View dictionary</li>
         <li>POST /transpile - Transpile German HTML</li>
+        <li>POST /format - Format German HTML</li>
+        <li>WebSocket /ws - Live transpiling while editing</li>
     </ul>
 </body>
 </html>`)
@@ -347,10 +424,14 @@ func runServer() {
 	fmt.Printf("API available at: http://localhost:%s\n", port)
 	fmt.Printf("Health check: http://localhost:%s/health\n", port)
 	fmt.Printf("Transpile endpoint: http://localhost:%s/transpile\n", port)
+	fmt.Printf("Format endpoint: http://localhost:%s/format\n", port)
 	fmt.Printf("Dictionary endpoint: http://localhost:%s/dictionary\n", port)
+	fmt.Printf("Live transpile: ws://localhost:%s%s\n", port, LIVE_TRANSPILE_PATH)
 	
 	// Check if static files exist
-	if _, err := os.Stat("./static"); err == nil {
+	if siteDir != "" {
+		fmt.Printf("✓ Serving %s with live reload at http://localhost:%s/\n", siteDir, port)
+	} else if _, err := os.Stat("./static"); err == nil {
 		fmt.Println("✓ Static files found - serving frontend")
 	} else {
 		fmt.Println("⚠ No static files found - API only mode")
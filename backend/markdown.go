@@ -0,0 +1,1092 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Markdown blocks. The content of
+//
+//	<markdown>
+//	  # Speisekarte
+//	  Alles *frisch*.
+//	</markdown>
+//
+// or of any element with format="markdown" is read as CommonMark and turned
+// into elements while parsing. <markdown> itself disappears, other elements
+// keep their tag and lose the format attribute. HTML in the Markdown is
+// escaped, not passed through, and links to javascript:, vbscript: and data:
+// URLs stay text.
+const (
+	MARKDOWN_TAG              = "markdown"
+	MARKDOWN_FORMAT_ATTRIBUTE = "format"
+	MARKDOWN_FORMAT           = "markdown"
+	markdownTabWidth          = 4
+)
+
+var (
+	atxHeadingPattern    = regexp.MustCompile(`^(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	thematicBreakPattern = regexp.MustCompile(`^(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	setextPattern        = regexp.MustCompile(`^(=+|-+)[ \t]*$`)
+	fencePattern         = regexp.MustCompile("^(`{3,}|~{3,})[ \t]*([^`]*?)[ \t]*$")
+	bulletPattern        = regexp.MustCompile(`^([-+*])([ \t]+|$)`)
+	orderedPattern       = regexp.MustCompile(`^([0-9]{1,9})([.)])([ \t]+|$)`)
+	referencePattern     = regexp.MustCompile(`^\[((?:[^\]\\]|\\.)+)\]:[ \t]*(<[^>\n]*>|\S+)(?:[ \t]+("[^"]*"|'[^']*'|\([^)]*\)))?[ \t]*$`)
+	entityPattern        = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[A-Za-z][A-Za-z0-9]{1,31});`)
+	safeDataImagePattern = regexp.MustCompile(`^data:image/(?:gif|png|jpeg|webp);`)
+	autolinkPattern      = regexp.MustCompile(`^<([A-Za-z][A-Za-z0-9+.-]{1,31}:[^<>\s]*|[A-Za-z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?(?:\.[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?)*)>`)
+)
+
+// isMarkdownElement reports whether an element's content is Markdown
+func isMarkdownElement(e *Element) bool {
+	return e.SourceName == MARKDOWN_TAG || sourceAttribute(e, MARKDOWN_FORMAT_ATTRIBUTE) == MARKDOWN_FORMAT
+}
+
+// expandMarkdown converts the content of the Markdown elements of a document
+func expandMarkdown(document *Document, dictionary *Dictionary) {
+	Rewrite(document, func(node Node) Node {
+		element, ok := node.(*Element)
+		if !ok || !isMarkdownElement(element) {
+			return node
+		}
+
+		var converted []Node
+		for _, child := range element.Children {
+			if text, ok := child.(*TextNode); ok {
+				converted = append(converted, markdownToNodes(text.Content, text.Pos, dictionary)...)
+			} else {
+				converted = append(converted, child)
+			}
+		}
+
+		if element.SourceName == MARKDOWN_TAG {
+			return &Document{Children: converted}
+		}
+		// A paragraph cannot hold one, so <absatz format="markdown"> takes the
+		// content of a single paragraph
+		if phrasingHosts[element.TagName] && len(converted) == 1 {
+			if p, ok := converted[0].(*Element); ok && p.TagName == "p" {
+				converted = p.Children
+			}
+		}
+		element.Attributes = withoutAttribute(element.Attributes, MARKDOWN_FORMAT_ATTRIBUTE)
+		element.Children = converted
+		return element
+	})
+}
+
+// phrasingHosts are the HTML elements that may only hold inline content
+var phrasingHosts = map[string]bool{
+	"p": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"a": true, "abbr": true, "b": true, "button": true, "cite": true, "dt": true, "em": true,
+	"i": true, "label": true, "legend": true, "q": true, "small": true, "span": true,
+	"strong": true, "summary": true, "u": true,
+}
+
+// safeDestination reports whether a link or image destination is not a URL
+// that runs script. Images may also use inline data in common formats.
+func safeDestination(destination string, image bool) bool {
+	// Browsers decode entities and ignore tabs, newlines and leading control
+	// characters before they read the scheme
+	url := strings.TrimLeftFunc(html.UnescapeString(destination), func(r rune) bool { return r <= ' ' })
+	url = strings.ToLower(strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(url))
+	switch {
+	case strings.HasPrefix(url, "javascript:"), strings.HasPrefix(url, "vbscript:"):
+		return false
+	case strings.HasPrefix(url, "data:"):
+		return image && safeDataImagePattern.MatchString(url)
+	}
+	return true
+}
+
+// withoutAttribute drops an attribute by its German name
+func withoutAttribute(attributes []*Attribute, name string) []*Attribute {
+	var kept []*Attribute
+	for _, attr := range attributes {
+		if attr.SourceName != name {
+			kept = append(kept, attr)
+		}
+	}
+	return kept
+}
+
+// markdownLine is a line of Markdown with where it starts in the source
+type markdownLine struct {
+	text string
+	pos  Position
+}
+
+// markdownConverter turns Markdown into AST nodes
+type markdownConverter struct {
+	dictionary *Dictionary
+	references map[string]markdownLink
+}
+
+type markdownLink struct {
+	destination string
+	title       string
+}
+
+// markdownToNodes converts Markdown source starting at pos into nodes. The
+// source may be indented as a whole to match the surrounding markup.
+func markdownToNodes(source string, pos Position, dictionary *Dictionary) []Node {
+	c := &markdownConverter{dictionary: dictionary, references: map[string]markdownLink{}}
+	lines := splitMarkdownLines(source, pos)
+	c.collectReferences(lines)
+	return c.blocks(lines)
+}
+
+// splitMarkdownLines splits source into lines with tabs expanded and the
+// indentation common to all lines removed
+func splitMarkdownLines(source string, pos Position) []markdownLine {
+	var lines []markdownLine
+	for _, text := range strings.Split(source, "\n") {
+		lines = append(lines, markdownLine{text: expandTabs(strings.TrimRight(text, "\r")), pos: pos})
+		pos = advance(pos, text+"\n")
+	}
+
+	// Text on the line of the opening tag does not count towards the indentation
+	sameLine := !isBlankLine(lines[0].text)
+	common := -1
+	for i, line := range lines {
+		if isBlankLine(line.text) || (i == 0 && sameLine) {
+			continue
+		}
+		if indent := indentation(line.text); common < 0 || indent < common {
+			common = indent
+		}
+	}
+	for i := range lines {
+		strip := common
+		if i == 0 && sameLine {
+			strip = 0
+		}
+		if indent := indentation(lines[i].text); indent < strip {
+			strip = indent
+		}
+		if strip > 0 {
+			lines[i].text = lines[i].text[strip:]
+			lines[i].pos = advance(lines[i].pos, strings.Repeat(" ", strip))
+		}
+	}
+	return lines
+}
+
+func expandTabs(text string) string {
+	if !strings.Contains(text, "\t") {
+		return text
+	}
+	var out strings.Builder
+	column := 0
+	for _, r := range text {
+		if r == '\t' {
+			spaces := markdownTabWidth - column%markdownTabWidth
+			out.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		out.WriteRune(r)
+		column++
+	}
+	return out.String()
+}
+
+// indentation counts the leading spaces of a line
+func indentation(text string) int {
+	return len(text) - len(strings.TrimLeft(text, " "))
+}
+
+func isBlankLine(text string) bool {
+	return strings.TrimSpace(text) == ""
+}
+
+// collectReferences records the link reference definitions of a document,
+// found at the start of paragraphs, and blanks their lines
+func (c *markdownConverter) collectReferences(lines []markdownLine) {
+	paragraphStart := true
+	fence := ""
+	for i := range lines {
+		text := lines[i].text
+		trimmed := strings.TrimLeft(text, " ")
+		if match := fencePattern.FindStringSubmatch(trimmed); match != nil && indentation(text) < 4 {
+			switch {
+			case fence == "":
+				fence = match[1]
+			case strings.HasPrefix(match[1], fence[:1]) && len(match[1]) >= len(fence) && match[2] == "":
+				fence = ""
+			}
+			paragraphStart = false
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+		if isBlankLine(text) {
+			paragraphStart = true
+			continue
+		}
+		if paragraphStart && indentation(text) < 4 {
+			if match := referencePattern.FindStringSubmatch(trimmed); match != nil {
+				label := normalizeLabel(match[1])
+				if _, exists := c.references[label]; !exists {
+					destination := strings.TrimSuffix(strings.TrimPrefix(match[2], "<"), ">")
+					title := ""
+					if len(match[3]) >= 2 {
+						title = match[3][1 : len(match[3])-1]
+					}
+					c.references[label] = markdownLink{destination: unescapeMarkdown(destination), title: unescapeMarkdown(title)}
+				}
+				lines[i].text = ""
+				continue
+			}
+		}
+		paragraphStart = false
+	}
+}
+
+// normalizeLabel makes link labels compare case- and space-insensitively
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// element creates an element from an HTML tag name, named as the dictionary
+// would spell it in German
+func (c *markdownConverter) element(tag string, pos Position, children ...Node) *Element {
+	e := &Element{SourceName: tag, TagName: tag, Kind: NAME_PASSTHROUGH, Children: children, Pos: pos}
+	if german, ok := c.dictionary.GermanTag(tag); ok {
+		e.SourceName = german
+		e.Kind = NAME_TRANSLATED
+	}
+	if e.Children == nil {
+		e.Children = []Node{}
+	}
+	return e
+}
+
+// setAttribute adds an attribute by its HTML name; value is plain text
+func (c *markdownConverter) setAttribute(e *Element, name, value string) {
+	attr := &Attribute{SourceName: name, Name: name, Kind: NAME_PASSTHROUGH, Value: escapeMarkdownText(value), Pos: e.Pos}
+	if german, ok := c.dictionary.GermanAttribute(name); ok {
+		attr.SourceName = german
+		attr.Kind = NAME_TRANSLATED
+	}
+	e.Attributes = append(e.Attributes, attr)
+}
+
+// blocks converts lines into block elements
+func (c *markdownConverter) blocks(lines []markdownLine) []Node {
+	var nodes []Node
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if isBlankLine(line.text) {
+			i++
+			continue
+		}
+
+		indent := indentation(line.text)
+		if indent >= 4 {
+			node, next := c.indentedCode(lines, i)
+			nodes = append(nodes, node)
+			i = next
+			continue
+		}
+
+		text := line.text[indent:]
+		pos := advance(line.pos, line.text[:indent])
+		switch {
+		case fencePattern.MatchString(text):
+			node, next := c.fencedCode(lines, i)
+			nodes = append(nodes, node)
+			i = next
+
+		case atxHeadingPattern.MatchString(text):
+			match := atxHeadingPattern.FindStringSubmatch(text)
+			heading := c.element("h"+strconv.Itoa(len(match[1])), pos)
+			heading.Children = c.inlines(match[2], pos)
+			nodes = append(nodes, heading)
+			i++
+
+		case thematicBreakPattern.MatchString(text):
+			hr := c.element("hr", pos)
+			hr.SelfClosing = true
+			nodes = append(nodes, hr)
+			i++
+
+		case strings.HasPrefix(text, ">"):
+			node, next := c.blockquote(lines, i)
+			nodes = append(nodes, node)
+			i = next
+
+		case listMarker(text) != nil:
+			node, next := c.list(lines, i)
+			nodes = append(nodes, node)
+			i = next
+
+		default:
+			node, next := c.paragraph(lines, i)
+			nodes = append(nodes, node)
+			i = next
+		}
+	}
+	return nodes
+}
+
+// startsBlock reports whether a line interrupts a paragraph
+func startsBlock(text string) bool {
+	if indentation(text) >= 4 {
+		return false
+	}
+	text = strings.TrimLeft(text, " ")
+	if fencePattern.MatchString(text) || atxHeadingPattern.MatchString(text) || thematicBreakPattern.MatchString(text) || strings.HasPrefix(text, ">") {
+		return true
+	}
+	// Only lists starting at 1 and non-empty items interrupt a paragraph
+	marker := listMarker(text)
+	return marker != nil && (!marker.ordered || marker.start == 1) && !isBlankLine(text[min(marker.width, len(text)):])
+}
+
+// paragraph reads a paragraph, which a setext underline turns into a heading
+func (c *markdownConverter) paragraph(lines []markdownLine, i int) (Node, int) {
+	pos := advance(lines[i].pos, lines[i].text[:indentation(lines[i].text)])
+	var text []string
+	for ; i < len(lines); i++ {
+		line := lines[i].text
+		if isBlankLine(line) || (len(text) > 0 && startsBlock(line) && !setextPattern.MatchString(strings.TrimLeft(line, " "))) {
+			break
+		}
+		if len(text) > 0 && indentation(line) < 4 {
+			if match := setextPattern.FindStringSubmatch(strings.TrimLeft(line, " ")); match != nil {
+				level := "h1"
+				if match[1][0] == '-' {
+					level = "h2"
+				}
+				heading := c.element(level, pos)
+				heading.Children = c.inlines(strings.Join(text, "\n"), pos)
+				return heading, i + 1
+			}
+		}
+		text = append(text, strings.TrimLeft(line, " "))
+	}
+
+	p := c.element("p", pos)
+	p.Children = c.inlines(strings.TrimRight(strings.Join(text, "\n"), " "), pos)
+	return p, i
+}
+
+// indentedCode reads a code block indented by four spaces
+func (c *markdownConverter) indentedCode(lines []markdownLine, i int) (Node, int) {
+	pos := lines[i].pos
+	var code []string
+	end := i
+	for ; i < len(lines); i++ {
+		line := lines[i].text
+		if isBlankLine(line) {
+			code = append(code, "")
+			continue
+		}
+		if indentation(line) < 4 {
+			break
+		}
+		code = append(code, line[4:])
+		end = i + 1
+	}
+	// Trailing blank lines are not part of the block
+	code = code[:len(code)-(i-end)]
+	return c.codeBlock(strings.Join(code, "\n")+"\n", "", pos), end
+}
+
+// fencedCode reads a code block between ``` or ~~~ fences
+func (c *markdownConverter) fencedCode(lines []markdownLine, i int) (Node, int) {
+	indent := indentation(lines[i].text)
+	pos := advance(lines[i].pos, lines[i].text[:indent])
+	match := fencePattern.FindStringSubmatch(lines[i].text[indent:])
+	fence, info := match[1], match[2]
+
+	var code []string
+	for i++; i < len(lines); i++ {
+		line := lines[i].text
+		closing := strings.TrimLeft(line, " ")
+		if indentation(line) < 4 && strings.HasPrefix(closing, fence) && strings.Trim(closing, fence[:1]+" ") == "" {
+			i++
+			break
+		}
+		// Content loses as much indentation as the opening fence had
+		strip := indent
+		if n := indentation(line); n < strip {
+			strip = n
+		}
+		code = append(code, line[strip:])
+	}
+
+	content := ""
+	if len(code) > 0 {
+		content = strings.Join(code, "\n") + "\n"
+	}
+	language := ""
+	if fields := strings.Fields(unescapeMarkdown(info)); len(fields) > 0 {
+		language = fields[0]
+	}
+	return c.codeBlock(content, language, pos), i
+}
+
+// codeBlock creates <pre><code> holding literal text
+func (c *markdownConverter) codeBlock(content, language string, pos Position) Node {
+	code := c.element("code", pos, &TextNode{Content: escapeMarkdownText(content), Pos: pos})
+	if language != "" {
+		c.setAttribute(code, "class", "language-"+language)
+	}
+	return c.element("pre", pos, code)
+}
+
+// blockquote reads a block quote; lines without > continue its last
+// paragraph
+func (c *markdownConverter) blockquote(lines []markdownLine, i int) (Node, int) {
+	pos := advance(lines[i].pos, lines[i].text[:indentation(lines[i].text)])
+	var inner []markdownLine
+	paragraph := false
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		indent := indentation(line.text)
+		text := line.text[indent:]
+		if indent < 4 && strings.HasPrefix(text, ">") {
+			strip := indent + 1
+			if strings.HasPrefix(text, "> ") {
+				strip++
+			}
+			content := line.text[strip:]
+			inner = append(inner, markdownLine{text: content, pos: advance(line.pos, line.text[:strip])})
+			paragraph = !isBlankLine(content) && (paragraph || !startsBlock(content)) && indentation(content) < 4
+			continue
+		}
+		// Lazy continuation
+		if paragraph && !isBlankLine(line.text) && !startsBlock(line.text) {
+			inner = append(inner, line)
+			continue
+		}
+		break
+	}
+	return c.element("blockquote", pos, c.blocks(inner)...), i
+}
+
+// markdownListMarker describes the marker of a list item
+type markdownListMarker struct {
+	ordered   bool
+	delimiter byte // -, +, * or . and )
+	start     int
+	width     int // marker and the spaces after it
+}
+
+// listMarker returns the list item marker a line starts with, or nil
+func listMarker(text string) *markdownListMarker {
+	if thematicBreakPattern.MatchString(text) {
+		return nil
+	}
+	if match := bulletPattern.FindStringSubmatch(text); match != nil {
+		return &markdownListMarker{delimiter: match[1][0], width: markerWidth(1, match[2])}
+	}
+	if match := orderedPattern.FindStringSubmatch(text); match != nil {
+		start, _ := strconv.Atoi(match[1])
+		return &markdownListMarker{ordered: true, delimiter: match[2][0], start: start, width: markerWidth(len(match[1])+1, match[3])}
+	}
+	return nil
+}
+
+// markerWidth is where item content starts: one to four spaces after the
+// marker, or one when the content is indented code or missing
+func markerWidth(marker int, spaces string) int {
+	if len(spaces) == 0 || len(spaces) > 4 {
+		return marker + 1
+	}
+	return marker + len(spaces)
+}
+
+// list reads consecutive items with the same kind of marker
+func (c *markdownConverter) list(lines []markdownLine, i int) (Node, int) {
+	indent := indentation(lines[i].text)
+	pos := advance(lines[i].pos, lines[i].text[:indent])
+	first := listMarker(lines[i].text[indent:])
+
+	tag := "ul"
+	if first.ordered {
+		tag = "ol"
+	}
+	list := c.element(tag, pos)
+	if first.ordered && first.start != 1 {
+		c.setAttribute(list, "start", strconv.Itoa(first.start))
+	}
+
+	var items [][]markdownLine
+	var starts []Position // of each item's marker
+	loose := false
+	for i < len(lines) {
+		indent := indentation(lines[i].text)
+		marker := listMarker(lines[i].text[indent:])
+		if indent >= 4 || marker == nil || marker.ordered != first.ordered || marker.delimiter != first.delimiter {
+			break
+		}
+		if len(items) > 0 && isBlankLine(lines[i-1].text) {
+			loose = true
+		}
+
+		// The item: its first line after the marker, then everything indented
+		// to its content, blank lines and lazy paragraph continuations
+		starts = append(starts, advance(lines[i].pos, lines[i].text[:indent]))
+		offset := indent + marker.width
+		if offset > len(lines[i].text) {
+			offset = len(lines[i].text)
+		}
+		item := []markdownLine{{text: lines[i].text[offset:], pos: advance(lines[i].pos, lines[i].text[:offset])}}
+		paragraph := !isBlankLine(item[0].text) && !startsBlock(item[0].text)
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if isBlankLine(line.text) {
+				// An item may start with at most one blank line
+				if len(item) == 1 && isBlankLine(item[0].text) {
+					break
+				}
+				item = append(item, markdownLine{pos: line.pos})
+				paragraph = false
+				continue
+			}
+			if indentation(line.text) >= offset {
+				content := line.text[offset:]
+				item = append(item, markdownLine{text: content, pos: advance(line.pos, line.text[:offset])})
+				paragraph = paragraph || !startsBlock(content)
+				continue
+			}
+			if paragraph && !startsBlock(line.text) && listMarker(strings.TrimLeft(line.text, " ")) == nil {
+				item = append(item, line)
+				continue
+			}
+			break
+		}
+
+		// Blank lines between the blocks of an item make the list loose
+		end := len(item)
+		for end > 0 && isBlankLine(item[end-1].text) {
+			end--
+		}
+		for j := 1; j < end; j++ {
+			if isBlankLine(item[j].text) && !isBlankLine(item[j-1].text) && c.separatesBlocks(item[:j], item[j:end]) {
+				loose = true
+			}
+		}
+		items = append(items, item[:end])
+	}
+
+	// An empty item has no lines left, so it starts at its marker
+	for n, item := range items {
+		li := c.element("li", starts[n], c.blocks(item)...)
+		if !loose {
+			li.Children = unwrapParagraphs(li.Children)
+		}
+		list.Children = append(list.Children, li)
+	}
+	return list, i
+}
+
+// separatesBlocks reports whether a blank line inside an item lies between
+// two of its blocks rather than inside a code block
+func (c *markdownConverter) separatesBlocks(before, after []markdownLine) bool {
+	fences := 0
+	for _, line := range before {
+		if fencePattern.MatchString(strings.TrimLeft(line.text, " ")) && indentation(line.text) < 4 {
+			fences++
+		}
+	}
+	if fences%2 == 1 {
+		return false
+	}
+	// A blank line in a nested list belongs to the nested list
+	for _, line := range before[1:] {
+		if indentation(line.text) > 0 && listMarker(strings.TrimLeft(line.text, " ")) != nil {
+			return false
+		}
+	}
+	return len(after) > 0
+}
+
+// unwrapParagraphs replaces the paragraphs of a tight list item by their content
+func unwrapParagraphs(nodes []Node) []Node {
+	var result []Node
+	for _, node := range nodes {
+		if element, ok := node.(*Element); ok && element.TagName == "p" {
+			result = append(result, element.Children...)
+			continue
+		}
+		result = append(result, node)
+	}
+	return result
+}
+
+// markdownInline is a piece of a paragraph while emphasis is resolved: a
+// node, or a run of * or _ that may open or close emphasis
+type markdownInline struct {
+	node      Node
+	delimiter byte
+	count     int
+	original  int
+	open      bool
+	close     bool
+}
+
+// inlines converts the text of a paragraph or heading into nodes
+func (c *markdownConverter) inlines(text string, pos Position) []Node {
+	var pieces []*markdownInline
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			pieces = append(pieces, &markdownInline{node: &TextNode{Content: literal.String(), Pos: pos}})
+			literal.Reset()
+		}
+	}
+	add := func(node Node) {
+		flush()
+		pieces = append(pieces, &markdownInline{node: node})
+	}
+
+	for i := 0; i < len(text); {
+		ch := text[i]
+		switch {
+		case ch == '\\' && i+1 < len(text) && text[i+1] == '\n':
+			add(c.lineBreak(pos))
+			i += 2
+			continue
+
+		case ch == '\\' && i+1 < len(text) && isASCIIPunctuation(text[i+1]):
+			literal.WriteString(escapeMarkdownText(text[i+1 : i+2]))
+			i += 2
+			continue
+
+		case ch == '\n':
+			// Two trailing spaces make a hard break
+			content := strings.TrimRight(literal.String(), " ")
+			hard := literal.Len()-len(content) >= 2
+			literal.Reset()
+			literal.WriteString(content)
+			if hard {
+				add(c.lineBreak(pos))
+			} else {
+				literal.WriteString("\n")
+			}
+			i++
+			for i < len(text) && text[i] == ' ' {
+				i++
+			}
+			continue
+
+		case ch == '`':
+			if code, end, ok := codeSpan(text, i); ok {
+				add(c.element("code", pos, &TextNode{Content: escapeMarkdownText(code), Pos: pos}))
+				i = end
+				continue
+			}
+			run := delimiterRun(text, i, '`')
+			literal.WriteString(text[i : i+run])
+			i += run
+			continue
+
+		case ch == '<':
+			if match := autolinkPattern.FindStringSubmatch(text[i:]); match != nil && safeDestination(match[1], false) {
+				destination := match[1]
+				if !strings.Contains(destination, ":") {
+					destination = "mailto:" + destination
+				}
+				link := c.element("a", pos, &TextNode{Content: escapeMarkdownText(match[1]), Pos: pos})
+				c.setAttribute(link, "href", destination)
+				add(link)
+				i += len(match[0])
+				continue
+			}
+
+		case ch == '[' || (ch == '!' && i+1 < len(text) && text[i+1] == '['):
+			if node, end, ok := c.link(text, i, pos); ok {
+				add(node)
+				i = end
+				continue
+			}
+
+		case ch == '*' || ch == '_':
+			run := delimiterRun(text, i, ch)
+			open, close := flanking(text, i, run)
+			if ch == '_' {
+				open, close = open && (!close || precededByPunctuation(text, i)), close && (!open || followedByPunctuation(text, i+run))
+			}
+			flush()
+			pieces = append(pieces, &markdownInline{delimiter: ch, count: run, original: run, open: open, close: close})
+			i += run
+			continue
+
+		case ch == '&':
+			if entity := entityPattern.FindString(text[i:]); entity != "" {
+				literal.WriteString(entity)
+				i += len(entity)
+				continue
+			}
+		}
+
+		literal.WriteString(escapeMarkdownText(text[i : i+1]))
+		i++
+	}
+	flush()
+
+	return c.emphasis(pieces, pos)
+}
+
+func (c *markdownConverter) lineBreak(pos Position) Node {
+	br := c.element("br", pos)
+	br.SelfClosing = true
+	return br
+}
+
+// emphasis matches delimiter runs into <em> and <strong>, following the
+// CommonMark rules, and returns the resulting nodes
+func (c *markdownConverter) emphasis(pieces []*markdownInline, pos Position) []Node {
+	for closer := 0; closer < len(pieces); closer++ {
+		cl := pieces[closer]
+		if cl.delimiter == 0 || !cl.close || cl.count == 0 {
+			continue
+		}
+		opener := -1
+		for o := closer - 1; o >= 0; o-- {
+			op := pieces[o]
+			if op.delimiter != cl.delimiter || !op.open || op.count == 0 {
+				continue
+			}
+			// The rule of three: runs that can both open and close only match
+			// if their lengths do not add up to a multiple of three
+			if (op.close || cl.open) && (op.original+cl.original)%3 == 0 && (op.original%3 != 0 || cl.original%3 != 0) {
+				continue
+			}
+			opener = o
+			break
+		}
+		if opener < 0 {
+			continue
+		}
+
+		op := pieces[opener]
+		tag, used := "em", 1
+		if op.count >= 2 && cl.count >= 2 {
+			tag, used = "strong", 2
+		}
+		op.count -= used
+		cl.count -= used
+
+		wrapped := &markdownInline{node: c.element(tag, pos, inlineNodes(pieces[opener+1:closer], pos)...)}
+		rest := append([]*markdownInline{wrapped}, pieces[closer:]...)
+		pieces = append(pieces[:opener+1], rest...)
+		closer = opener // continue with the same closer, now at opener+2
+	}
+	return inlineNodes(pieces, pos)
+}
+
+// inlineNodes turns pieces into nodes; unmatched delimiters are text
+func inlineNodes(pieces []*markdownInline, pos Position) []Node {
+	var nodes []Node
+	for _, piece := range pieces {
+		node := piece.node
+		if piece.delimiter != 0 {
+			if piece.count == 0 {
+				continue
+			}
+			node = &TextNode{Content: strings.Repeat(string(piece.delimiter), piece.count), Pos: pos}
+		}
+		// Merge neighbouring text
+		if text, ok := node.(*TextNode); ok && len(nodes) > 0 {
+			if previous, ok := nodes[len(nodes)-1].(*TextNode); ok {
+				nodes[len(nodes)-1] = &TextNode{Content: previous.Content + text.Content, Pos: previous.Pos}
+				continue
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// link parses [text](destination "title"), [text][label], [label] and the
+// image forms starting with !
+func (c *markdownConverter) link(text string, i int, pos Position) (Node, int, bool) {
+	image := text[i] == '!'
+	start := i + 1
+	if image {
+		start++
+	}
+	end := closingBracket(text, start)
+	if end < 0 {
+		return nil, 0, false
+	}
+	label := text[start:end]
+
+	var target markdownLink
+	next := end + 1
+	found := false
+	if next < len(text) && text[next] == '(' {
+		target, next, found = inlineDestination(text, next)
+	}
+	if !found && next < len(text) && text[next] == '[' {
+		if close := strings.IndexByte(text[next:], ']'); close >= 0 {
+			reference := text[next+1 : next+close]
+			if reference == "" {
+				reference = label
+			}
+			target, found = c.references[normalizeLabel(reference)]
+			next += close + 1
+		}
+	}
+	if !found {
+		target, found = c.references[normalizeLabel(label)]
+		next = end + 1
+	}
+	if !found || !safeDestination(target.destination, image) {
+		return nil, 0, false
+	}
+
+	if image {
+		img := c.element("img", pos)
+		img.SelfClosing = true
+		c.setAttribute(img, "src", target.destination)
+		c.setAttribute(img, "alt", plainText(c.inlines(label, pos)))
+		if target.title != "" {
+			c.setAttribute(img, "title", target.title)
+		}
+		return img, next, true
+	}
+
+	// Links do not nest
+	children := c.inlines(label, pos)
+	nested := false
+	for _, child := range children {
+		Inspect(child, func(node Node) bool {
+			if element, ok := node.(*Element); ok && element.TagName == "a" {
+				nested = true
+			}
+			return !nested
+		})
+	}
+	if nested {
+		return nil, 0, false
+	}
+	a := c.element("a", pos, children...)
+	c.setAttribute(a, "href", target.destination)
+	if target.title != "" {
+		c.setAttribute(a, "title", target.title)
+	}
+	return a, next, true
+}
+
+// closingBracket finds the ] matching the [ before start, skipping escapes
+// and code spans
+func closingBracket(text string, start int) int {
+	depth := 0
+	for i := start; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '`':
+			if _, end, ok := codeSpan(text, i); ok {
+				i = end - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// inlineDestination parses (destination "title") starting at the parenthesis
+func inlineDestination(text string, i int) (markdownLink, int, bool) {
+	i++
+	skipSpace := func() {
+		for i < len(text) && (text[i] == ' ' || text[i] == '\n') {
+			i++
+		}
+	}
+	skipSpace()
+
+	var link markdownLink
+	if i < len(text) && text[i] == '<' {
+		end := strings.IndexAny(text[i+1:], ">\n")
+		if end < 0 || text[i+1+end] != '>' {
+			return link, 0, false
+		}
+		link.destination = text[i+1 : i+1+end]
+		i += end + 2
+	} else {
+		start, depth := i, 0
+		for ; i < len(text); i++ {
+			ch := text[i]
+			if ch == '\\' && i+1 < len(text) {
+				i++
+				continue
+			}
+			if ch == ' ' || ch == '\n' || unicode.IsControl(rune(ch)) {
+				break
+			}
+			if ch == '(' {
+				depth++
+			}
+			if ch == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			}
+		}
+		link.destination = text[start:i]
+	}
+	link.destination = unescapeMarkdown(link.destination)
+
+	skipSpace()
+	if i < len(text) && (text[i] == '"' || text[i] == '\'' || text[i] == '(') {
+		closing := text[i]
+		if closing == '(' {
+			closing = ')'
+		}
+		end := strings.IndexByte(text[i+1:], closing)
+		if end < 0 {
+			return link, 0, false
+		}
+		link.title = unescapeMarkdown(text[i+1 : i+1+end])
+		i += end + 2
+		skipSpace()
+	}
+	if i >= len(text) || text[i] != ')' {
+		return link, 0, false
+	}
+	return link, i + 1, true
+}
+
+// codeSpan parses a code span starting at a backtick run and returns its
+// content and the index after it
+func codeSpan(text string, i int) (string, int, bool) {
+	run := delimiterRun(text, i, '`')
+	for j := i + run; j < len(text); {
+		if text[j] != '`' {
+			j++
+			continue
+		}
+		closing := delimiterRun(text, j, '`')
+		if closing == run {
+			content := strings.ReplaceAll(text[i+run:j], "\n", " ")
+			if len(content) > 2 && content[0] == ' ' && content[len(content)-1] == ' ' && strings.Trim(content, " ") != "" {
+				content = content[1 : len(content)-1]
+			}
+			return content, j + closing, true
+		}
+		j += closing
+	}
+	return "", 0, false
+}
+
+// delimiterRun counts the repetitions of ch starting at i
+func delimiterRun(text string, i int, ch byte) int {
+	n := 0
+	for i+n < len(text) && text[i+n] == ch {
+		n++
+	}
+	return n
+}
+
+// flanking reports whether a delimiter run is left-flanking (may open) and
+// right-flanking (may close)
+func flanking(text string, i, run int) (bool, bool) {
+	before, after := ' ', ' '
+	if i > 0 {
+		before = lastRune(text[:i])
+	}
+	if i+run < len(text) {
+		after = []rune(text[i+run:])[0]
+	}
+	beforeSpace, afterSpace := unicode.IsSpace(before), unicode.IsSpace(after)
+	beforePunct, afterPunct := unicode.IsPunct(before) || unicode.IsSymbol(before), unicode.IsPunct(after) || unicode.IsSymbol(after)
+
+	left := !afterSpace && (!afterPunct || beforeSpace || beforePunct)
+	right := !beforeSpace && (!beforePunct || afterSpace || afterPunct)
+	return left, right
+}
+
+func precededByPunctuation(text string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	r := lastRune(text[:i])
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+func followedByPunctuation(text string, i int) bool {
+	if i >= len(text) {
+		return false
+	}
+	r := []rune(text[i:])[0]
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+func lastRune(text string) rune {
+	runes := []rune(text)
+	return runes[len(runes)-1]
+}
+
+func isASCIIPunctuation(ch byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", ch) >= 0
+}
+
+// unescapeMarkdown removes backslash escapes
+func unescapeMarkdown(text string) string {
+	if !strings.Contains(text, "\\") {
+		return text
+	}
+	var out strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) && isASCIIPunctuation(text[i+1]) {
+			i++
+		}
+		out.WriteByte(text[i])
+	}
+	return out.String()
+}
+
+// escapeMarkdownText escapes text for HTML, leaving entity references alone
+func escapeMarkdownText(text string) string {
+	var out strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '<':
+			out.WriteString("&lt;")
+		case '>':
+			out.WriteString("&gt;")
+		case '&':
+			if entityPattern.MatchString(text[i:]) {
+				out.WriteByte('&')
+			} else {
+				out.WriteString("&amp;")
+			}
+		default:
+			out.WriteByte(text[i])
+		}
+	}
+	return out.String()
+}
+
+// plainText returns the text of nodes without markup, for alt attributes
+func plainText(nodes []Node) string {
+	var text strings.Builder
+	for _, node := range nodes {
+		Inspect(node, func(n Node) bool {
+			if t, ok := n.(*TextNode); ok {
+				text.WriteString(t.Content)
+			}
+			return true
+		})
+	}
+	// setAttribute escapes again
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(text.String())
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestMarkdown(t *testing.T) {
+	for _, test := range []struct {
+		input, want string
+	}{
+		// Empty list items
+		{"<markdown>-\n</markdown>", "<ul><li></li></ul>"},
+		{"<markdown>1.\n</markdown>", "<ol><li></li></ol>"},
+		{"<markdown>*\n</markdown>", "<ul><li></li></ul>"},
+		{"<markdown>\n- a\n-\n- b\n</markdown>", "<ul><li>a</li><li></li><li>b</li></ul>"},
+		{"<markdown>a\n-\n</markdown>", "<h2>a</h2>"},
+
+		// Blocks
+		{"<markdown>\n  # Titel\n\n  Alles *frisch*.\n</markdown>", "<h1>Titel</h1><p>Alles <em>frisch</em>.</p>"},
+		{"<markdown>\n- a\n\n- b\n</markdown>", "<ul><li><p>a</p></li><li><p>b</p></li></ul>"},
+		{"<markdown>\n3) a\n4) b\n</markdown>", `<ol start="3"><li>a</li><li>b</li></ol>`},
+		{"<markdown>> zitat\n</markdown>", "<blockquote><p>zitat</p></blockquote>"},
+		{"<markdown>\n```go\nx < y\n```\n</markdown>", "<pre><code class=\"language-go\">x &lt; y\n</code></pre>"},
+		{"<markdown><b>fett</b></markdown>", "<p>&lt;b&gt;fett&lt;/b&gt;</p>"},
+
+		// Hosts that only take inline content lose the paragraph
+		{`<absatz format="markdown">*hi*</absatz>`, "<p><em>hi</em></p>"},
+		{`<überschrift2 format="markdown">a ` + "`b`" + `</überschrift2>`, "<h2>a <code>b</code></h2>"},
+		{`<abschnitt format="markdown">*hi*</abschnitt>`, "<section><p><em>hi</em></p></section>"},
+
+		// Links
+		{"<markdown>[ok](/seite \"T\") <https://example.org> <a@b.de></markdown>", `<p><a href="/seite" title="T">ok</a> <a href="https://example.org">https://example.org</a> <a href="mailto:a@b.de">a@b.de</a></p>`},
+		{"<markdown>[x](javascript:alert(1))</markdown>", "<p>[x](javascript:alert(1))</p>"},
+		{"<markdown>[x](JavaScript&#58;alert(1))</markdown>", "<p>[x](JavaScript&#58;alert(1))</p>"},
+		{"<markdown><javascript:alert(1)></markdown>", "<p>&lt;javascript:alert(1)&gt;</p>"},
+		{"<markdown>[x][r]\n\n[r]: vbscript:x\n</markdown>", "<p>[x][r]</p>"},
+		{"<markdown>[x](data:text/html,x) ![b](data:image/png;base64,AA)</markdown>", `<p>[x](data:text/html,x) <img src="data:image/png;base64,AA" alt="b" /></p>`},
+	} {
+		transpiler := NewTranspiler()
+		transpiler.SetOutput(MODE_COMPACT, 0)
+		got, err := transpiler.Transpile(test.input)
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q:\n got %s\nwant %s", test.input, got, test.want)
+		}
+	}
+}
@@ -11,6 +11,7 @@ type Parser struct {
 	currentToken Token
 	peekToken    Token
 	dictionary   *Dictionary
+	filename     string
 }
 
 // NewParser creates a new parser instance
@@ -27,6 +28,29 @@ func NewParser(lexer *Lexer, dictionary *Dictionary) *Parser {
 	return p
 }
 
+// SetFilename sets the file name recorded in node positions and errors
+func (p *Parser) SetFilename(filename string) {
+	p.filename = filename
+}
+
+// position returns the position of the current token
+func (p *Parser) position() Position {
+	return tokenPosition(p.filename, p.currentToken)
+}
+
+// endPosition returns the position just after the current token
+func (p *Parser) endPosition() Position {
+	pos := p.position()
+	pos.Offset += len(p.currentToken.Value)
+	pos.Column += len(p.currentToken.Value)
+	return pos
+}
+
+// errorf returns a syntax error at the current token
+func (p *Parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Pos: p.position(), Message: fmt.Sprintf(format, args...)}
+}
+
 // nextToken advances to the next token
 func (p *Parser) nextToken() {
 	p.currentToken = p.peekToken
@@ -60,9 +84,9 @@ func (p *Parser) parseNode() (Node, error) {
 		if strings.TrimSpace(p.currentToken.Value) == "" {
 			return nil, nil // Skip empty text nodes
 		}
-		return &TextNode{Content: p.currentToken.Value}, nil
+		return &TextNode{Content: p.currentToken.Value, Pos: p.position()}, nil
 	default:
-		return nil, fmt.Errorf("unexpected token: %s", p.currentToken)
+		return nil, p.errorf("unexpected token: %s", p.currentToken)
 	}
 }
 
@@ -70,26 +94,26 @@ func (p *Parser) parseNode() (Node, error) {
 func (p *Parser) parseElement() (*Element, error) {
 	// Expect opening tag
 	if p.currentToken.Type != TOKEN_TAG_OPEN {
-		return nil, fmt.Errorf("expected '<', got %s", p.currentToken)
+		return nil, p.errorf("expected '<', got %s", p.currentToken)
 	}
 	
+	pos := p.position()
 	p.nextToken() // consume '<'
 	
 	// Get tag name
 	if p.currentToken.Type != TOKEN_TAG_NAME {
-		return nil, fmt.Errorf("expected tag name, got %s", p.currentToken)
+		return nil, p.errorf("expected tag name, got %s", p.currentToken)
 	}
 	
-	germanTagName := p.currentToken.Value
-	htmlTagName, exists := p.dictionary.TranslateTag(germanTagName)
-	if !exists {
-		htmlTagName = germanTagName // Keep original if no translation exists
-	}
+	sourceTagName := p.currentToken.Value
+	htmlTagName, kind := p.dictionary.LookupTag(sourceTagName)
 	
 	element := &Element{
+		SourceName: sourceTagName,
 		TagName:    htmlTagName,
-		Attributes: make(map[string]string),
+		Kind:       kind,
 		Children:   []Node{},
+		Pos:        pos,
 	}
 	
 	p.nextToken() // consume tag name
@@ -100,18 +124,23 @@ func (p *Parser) parseElement() (*Element, error) {
 		if err != nil {
 			return nil, err
 		}
-		element.Attributes[attr.Name] = attr.Value
+		// Later duplicates win, as they did when attributes were kept in a map
+		if _, exists := element.GetAttribute(attr.Name); exists {
+			element.RemoveAttribute(attr.Name)
+		}
+		element.Attributes = append(element.Attributes, attr)
 	}
 	
 	// Check for self-closing tag
 	if p.currentToken.Type == TOKEN_TAG_CLOSE_SLASH {
 		element.SelfClosing = true
+		element.End = p.endPosition()
 		return element, nil
 	}
 	
 	// Expect closing '>'
 	if p.currentToken.Type != TOKEN_TAG_CLOSE {
-		return nil, fmt.Errorf("expected '>' or '/>', got %s", p.currentToken)
+		return nil, p.errorf("expected '>' or '/>', got %s", p.currentToken)
 	}
 	
 	p.nextToken() // consume '>'
@@ -130,7 +159,7 @@ func (p *Parser) parseElement() (*Element, error) {
 	
 	// Check if we hit EOF without finding closing tag
 	if p.currentToken.Type == TOKEN_EOF {
-		return nil, fmt.Errorf("unexpected end of input: missing closing tag for <%s>", htmlTagName)
+		return nil, &SyntaxError{Pos: pos, Message: fmt.Sprintf("unexpected end of input: missing closing tag for <%s>", sourceTagName)}
 	}
 	
 	// Parse closing tag
@@ -138,48 +167,38 @@ func (p *Parser) parseElement() (*Element, error) {
 		p.nextToken() // consume '</'
 		
 		if p.currentToken.Type != TOKEN_TAG_NAME {
-			return nil, fmt.Errorf("expected closing tag name, got %s", p.currentToken)
+			return nil, p.errorf("expected closing tag name, got %s", p.currentToken)
 		}
 		
 		closingTagName := p.currentToken.Value
-		closingHtmlTagName, exists := p.dictionary.TranslateTag(closingTagName)
-		if !exists {
-			closingHtmlTagName = closingTagName
-		}
+		closingHtmlTagName, _ := p.dictionary.LookupTag(closingTagName)
 		
+		// Compare resolved names so <döner> may be closed by </dokument>
 		if closingHtmlTagName != htmlTagName {
-			return nil, fmt.Errorf("mismatched closing tag: expected %s, got %s", htmlTagName, closingHtmlTagName)
+			return nil, p.errorf("mismatched closing tag: expected </%s>, got </%s>", sourceTagName, closingTagName)
 		}
 		
 		p.nextToken() // consume closing tag name
 		
 		if p.currentToken.Type != TOKEN_TAG_CLOSE {
-			return nil, fmt.Errorf("expected '>', got %s", p.currentToken)
+			return nil, p.errorf("expected '>', got %s", p.currentToken)
 		}
+		element.End = p.endPosition()
 	}
 	
 	return element, nil
 }
 
-// Attribute represents an HTML attribute
-type Attribute struct {
-	Name  string
-	Value string
-}
-
 // parseAttribute parses an HTML attribute
 func (p *Parser) parseAttribute() (*Attribute, error) {
 	if p.currentToken.Type != TOKEN_ATTR_NAME {
-		return nil, fmt.Errorf("expected attribute name, got %s", p.currentToken)
+		return nil, p.errorf("expected attribute name, got %s", p.currentToken)
 	}
 	
-	germanAttrName := p.currentToken.Value
-	htmlAttrName, exists := p.dictionary.TranslateAttribute(germanAttrName)
-	if !exists {
-		htmlAttrName = germanAttrName // Keep original if no translation exists
-	}
+	sourceAttrName := p.currentToken.Value
+	htmlAttrName, kind := p.dictionary.LookupAttribute(sourceAttrName)
 	
-	attr := &Attribute{Name: htmlAttrName}
+	attr := &Attribute{SourceName: sourceAttrName, Name: htmlAttrName, Kind: kind, Pos: p.position()}
 	
 	p.nextToken() // consume attribute name
 	
@@ -189,9 +208,13 @@ func (p *Parser) parseAttribute() (*Attribute, error) {
 		
 		if p.currentToken.Type == TOKEN_ATTR_VALUE {
 			attr.Value = p.currentToken.Value
+			attr.ValuePos = p.position()
+			if p.currentToken.Quote != 0 {
+				attr.ValuePos = advance(attr.ValuePos, string(p.currentToken.Quote))
+			}
 			p.nextToken() // consume attribute value
 		} else {
-			return nil, fmt.Errorf("expected attribute value, got %s", p.currentToken)
+			return nil, p.errorf("expected attribute value, got %s", p.currentToken)
 		}
 	}
 	
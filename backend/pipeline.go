@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Stage identifies where in the transpilation pipeline a pass runs
+type Stage int
+
+const (
+	STAGE_PRE_LEX        Stage = iota // text filter over the German source
+	STAGE_AST                         // transform over the parsed document
+	STAGE_POST_SERIALIZE              // text filter over the generated HTML
+)
+
+// String returns a string representation of the stage
+func (s Stage) String() string {
+	switch s {
+	case STAGE_PRE_LEX:
+		return "pre-lex"
+	case STAGE_AST:
+		return "ast"
+	case STAGE_POST_SERIALIZE:
+		return "post-serialize"
+	default:
+		return "unknown"
+	}
+}
+
+// TextFilter rewrites source or output text
+type TextFilter func(text string) (string, error)
+
+// Pass is a named step of the pipeline. Filter is used by the text stages,
+// Transform by STAGE_AST. Within a stage passes run by ascending Order and,
+// for equal Order, in registration order.
+type Pass struct {
+	Name        string
+	Description string
+	Stage       Stage
+	Order       int
+	Filter      TextFilter
+	Transform   Transform
+}
+
+// validate checks that the pass carries the function its stage needs
+func (p Pass) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("pass has no name")
+	}
+	switch p.Stage {
+	case STAGE_PRE_LEX, STAGE_POST_SERIALIZE:
+		if p.Filter == nil {
+			return fmt.Errorf("pass %q: %s stage requires a Filter", p.Name, p.Stage)
+		}
+	case STAGE_AST:
+		if p.Transform == nil {
+			return fmt.Errorf("pass %q: ast stage requires a Transform", p.Name)
+		}
+	default:
+		return fmt.Errorf("pass %q: unknown stage %d", p.Name, p.Stage)
+	}
+	return nil
+}
+
+// Pipeline holds the passes enabled on a transpiler
+type Pipeline struct {
+	passes []Pass
+}
+
+// Add appends a pass to the pipeline; names must be unique
+func (p *Pipeline) Add(pass Pass) error {
+	if err := pass.validate(); err != nil {
+		return err
+	}
+	if p.Has(pass.Name) {
+		return fmt.Errorf("pass %q is already enabled", pass.Name)
+	}
+	p.passes = append(p.passes, pass)
+	return nil
+}
+
+// mustAdd adds a pass the transpiler built itself; an error is a bug
+func (p *Pipeline) mustAdd(pass Pass) {
+	if err := p.Add(pass); err != nil {
+		panic(err)
+	}
+}
+
+// Remove drops the named pass and reports whether it was present
+func (p *Pipeline) Remove(name string) bool {
+	for i, pass := range p.passes {
+		if pass.Name == name {
+			p.passes = append(p.passes[:i], p.passes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Has reports whether the named pass is enabled
+func (p *Pipeline) Has(name string) bool {
+	for _, pass := range p.passes {
+		if pass.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Passes returns the passes of a stage in execution order
+func (p *Pipeline) Passes(stage Stage) []Pass {
+	var passes []Pass
+	for _, pass := range p.passes {
+		if pass.Stage == stage {
+			passes = append(passes, pass)
+		}
+	}
+	sort.SliceStable(passes, func(i, j int) bool {
+		return passes[i].Order < passes[j].Order
+	})
+	return passes
+}
+
+// runFilters applies the text filters of a stage in order
+func (p *Pipeline) runFilters(stage Stage, text string) (string, error) {
+	for _, pass := range p.Passes(stage) {
+		var err error
+		if text, err = pass.Filter(text); err != nil {
+			return "", fmt.Errorf("pass %q: %w", pass.Name, err)
+		}
+	}
+	return text, nil
+}
+
+// runTransforms applies the AST transforms in order
+func (p *Pipeline) runTransforms(doc *Document) error {
+	for _, pass := range p.Passes(STAGE_AST) {
+		if err := pass.Transform(doc); err != nil {
+			return fmt.Errorf("pass %q: %w", pass.Name, err)
+		}
+	}
+	return nil
+}
+
+// passRegistry holds the passes that can be enabled by name from config.
+// Passes are usually registered from init, but the server looks them up
+// from request goroutines, so access goes through passRegistryMutex.
+var (
+	passRegistry      = map[string]Pass{}
+	passRegistryMutex sync.RWMutex
+)
+
+// RegisterPass makes a pass available to EnablePasses and the config file
+func RegisterPass(pass Pass) error {
+	if err := pass.validate(); err != nil {
+		return err
+	}
+	passRegistryMutex.Lock()
+	defer passRegistryMutex.Unlock()
+	if _, exists := passRegistry[pass.Name]; exists {
+		return fmt.Errorf("pass %q is already registered", pass.Name)
+	}
+	passRegistry[pass.Name] = pass
+	return nil
+}
+
+// LookupPass returns the registered pass with the given name
+func LookupPass(name string) (Pass, bool) {
+	passRegistryMutex.RLock()
+	defer passRegistryMutex.RUnlock()
+	pass, exists := passRegistry[name]
+	return pass, exists
+}
+
+// AvailablePasses returns the names of all registered passes, sorted
+func AvailablePasses() []string {
+	passRegistryMutex.RLock()
+	defer passRegistryMutex.RUnlock()
+	names := make([]string, 0, len(passRegistry))
+	for name := range passRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func mustRegisterPass(pass Pass) {
+	if err := RegisterPass(pass); err != nil {
+		panic(err)
+	}
+}
+
+func init() {
+	mustRegisterPass(Pass{
+		Name:        "normalize-newlines",
+		Description: "convert CRLF and CR line endings in the source to LF",
+		Stage:       STAGE_PRE_LEX,
+		Filter: func(text string) (string, error) {
+			text = strings.ReplaceAll(text, "\r\n", "\n")
+			return strings.ReplaceAll(text, "\r", "\n"), nil
+		},
+	})
+	mustRegisterPass(Pass{
+		Name:        "lang-de",
+		Description: `add lang="de" to <html> elements that have no lang attribute`,
+		Stage:       STAGE_AST,
+		Transform:   SetLanguage("de"),
+	})
+	mustRegisterPass(Pass{
+		Name:        "strip-event-handlers",
+		Description: "remove inline event handler attributes such as onclick",
+		Stage:       STAGE_AST,
+		Transform:   StripEventHandlers,
+	})
+	mustRegisterPass(Pass{
+		Name:        "doctype",
+		Description: "prefix the output with <!DOCTYPE html> when it is a full document",
+		Stage:       STAGE_POST_SERIALIZE,
+		Order:       100,
+		Filter: func(text string) (string, error) {
+			if strings.HasPrefix(text, "<html") {
+				return "<!DOCTYPE html>\n" + text, nil
+			}
+			return text, nil
+		},
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestAddTransformNamesAreUnique(t *testing.T) {
+	transpiler := NewTranspiler()
+	noop := func(*Document) error { return nil }
+	transpiler.AddTransform(noop, noop)
+	transpiler.pipeline.Remove("transform-1")
+	transpiler.AddTransform(noop, nil)
+
+	seen := map[string]bool{}
+	passes := transpiler.pipeline.Passes(STAGE_AST)
+	for _, pass := range passes {
+		if seen[pass.Name] {
+			t.Fatalf("pass name %q used twice", pass.Name)
+		}
+		seen[pass.Name] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("got %d transforms, want 2 (nil is skipped)", len(seen))
+	}
+}
+
+func TestMustAddPanicsOnInvalidPasses(t *testing.T) {
+	noop := func(*Document) error { return nil }
+	for _, pass := range []Pass{
+		{Name: "doppelt", Stage: STAGE_AST, Transform: noop},
+		{Name: "ohne-filter", Stage: STAGE_PRE_LEX},
+		{Name: "falsche-stufe", Stage: Stage(9), Transform: noop},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: added without a panic", pass.Name)
+				}
+			}()
+			pipeline := &Pipeline{}
+			pipeline.Add(Pass{Name: "doppelt", Stage: STAGE_AST, Transform: noop})
+			pipeline.mustAdd(pass)
+		}()
+	}
+}
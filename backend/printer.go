@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+)
+
+// PrintOptions controls how Print lays out a document
+type PrintOptions struct {
+	Indent         string // indentation unit per nesting level
+	SourceNames    bool   // print names as written in the source instead of the HTML names
+	SortAttributes bool   // print id and class first, the rest alphabetically
+
+	// Compact prints everything on one line, exactly as Node.String does
+	Compact bool
+
+	// SourceMap, when set, records where each node's output starts
+	SourceMap *SourceMap
+}
+
+// Print serialises a node with block elements on lines of their own, nested
+// ones indented, and attribute values always in double quotes. Text and
+// inline elements stay on one line, as a line break between them would add
+// a space to the rendered page.
+func Print(node Node, opts PrintOptions) string {
+	var out strings.Builder
+	Fprint(&out, node, opts)
+	return out.String()
+}
+
+// Fprint is Print writing to w as it goes
+func Fprint(w io.Writer, node Node, opts PrintOptions) error {
+	p := &printer{opts: opts, out: bufio.NewWriter(w)}
+	if opts.Compact {
+		p.printCompact(node)
+	} else {
+		p.printNode(node, 0)
+	}
+	return p.out.Flush()
+}
+
+// printer writes the layout described by PrintOptions
+type printer struct {
+	opts PrintOptions
+	out  *bufio.Writer
+
+	// Where the next output goes, tracked for the source map
+	lineNo int
+	column int
+
+	// Whether the current output line has been started, while inline
+	// content is printed
+	started bool
+}
+
+// phrasingTags are the HTML elements that flow within a line of text
+var phrasingTags = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "br": true, "button": true,
+	"cite": true, "code": true, "data": true, "del": true, "dfn": true, "em": true, "i": true,
+	"img": true, "input": true, "ins": true, "kbd": true, "label": true, "mark": true,
+	"meter": true, "output": true, "progress": true, "q": true, "s": true, "samp": true,
+	"select": true, "small": true, "span": true, "strong": true, "sub": true, "sup": true,
+	"time": true, "u": true, "var": true, "wbr": true,
+}
+
+// isInline reports whether a node flows within a line of text: text,
+// comments, and phrasing elements holding nothing else
+func isInline(node Node) bool {
+	switch n := node.(type) {
+	case *TextNode, *CommentNode:
+		return true
+	case *Element:
+		if !phrasingTags[n.TagName] || isMarkdownElement(n) {
+			return false
+		}
+		for _, child := range n.Children {
+			if !isInline(child) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (p *printer) printNode(node Node, depth int) {
+	switch n := node.(type) {
+	case *Document:
+		p.printChildren(n.Children, depth)
+	case *Element:
+		p.printElement(n, depth)
+	case nil:
+	default:
+		p.line(depth, n.String(), Position{})
+	}
+}
+
+// printChildren prints block nodes on lines of their own and each run of
+// inline nodes between them on one line
+func (p *printer) printChildren(children []Node, depth int) {
+	var run []Node
+	for _, child := range mergeText(children) {
+		if isInline(child) {
+			run = append(run, child)
+			continue
+		}
+		p.printRun(run, depth)
+		run = nil
+		p.printNode(child, depth)
+	}
+	p.printRun(run, depth)
+}
+
+// printRun prints inline nodes on one line, without the whitespace around them
+func (p *printer) printRun(run []Node, depth int) {
+	for i, node := range run {
+		p.printInline(node, depth, i == 0, i == len(run)-1)
+	}
+	p.endLine()
+}
+
+func (p *printer) printElement(e *Element, depth int) {
+	name := p.name(e.SourceName, e.TagName)
+	open := p.openTag(e, name)
+
+	if e.SelfClosing {
+		p.line(depth, open[:len(open)-1]+" />", e.Pos)
+		return
+	}
+
+	// Preformatted text and Markdown source keep their whitespace
+	if e.TagName == "pre" || isMarkdownElement(e) {
+		p.line(depth, p.verbatim(e), e.Pos)
+		return
+	}
+
+	// Elements holding one line of inline content stay on one line
+	inline := true
+	var content strings.Builder
+	for _, child := range e.Children {
+		inline = inline && isInline(child)
+		content.WriteString(child.String())
+	}
+	if inline && !strings.Contains(strings.TrimSpace(content.String()), "\n") {
+		p.printInline(e, depth, true, true)
+		p.endLine()
+		return
+	}
+
+	p.line(depth, open, e.Pos)
+	p.printChildren(e.Children, depth+1)
+	p.line(depth, "</"+name+">", e.Pos)
+}
+
+// printInline writes a node of a line of inline content. Text breaks lines
+// only where the source does; trimStart and trimEnd drop the whitespace at
+// the start and end of the content. A block element holding a single line
+// of inline content is printed this way too, so its edges are trimmed.
+func (p *printer) printInline(node Node, depth int, trimStart, trimEnd bool) {
+	switch n := node.(type) {
+	case *TextNode:
+		p.printText(n, depth, trimStart, trimEnd)
+	case *CommentNode:
+		p.startLine(depth)
+		p.mark(n.Pos)
+		p.write(n.String())
+	case *Element:
+		name := p.name(n.SourceName, n.TagName)
+		open := p.openTag(n, name)
+		p.startLine(depth)
+		p.mark(n.Pos)
+		if n.SelfClosing {
+			p.write(open[:len(open)-1] + " />")
+			return
+		}
+		p.write(open)
+
+		block := !phrasingTags[n.TagName]
+		children := mergeText(n.Children)
+		for i, child := range children {
+			p.printInline(child, depth, block && i == 0, block && i == len(children)-1)
+		}
+		p.startLine(depth)
+		p.mark(n.Pos)
+		p.write("</" + name + ">")
+	}
+}
+
+// printText writes text within a line, starting a new line wherever the
+// source has a line break
+func (p *printer) printText(n *TextNode, depth int, trimStart, trimEnd bool) {
+	content, pos := n.Content, n.Pos
+	if trimStart {
+		trimmed := strings.TrimLeft(content, " \t\r\n")
+		pos = advance(pos, content[:len(content)-len(trimmed)])
+		content = trimmed
+	}
+	if trimEnd {
+		content = strings.TrimRight(content, " \t\r\n")
+	}
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		text := line
+		if i > 0 {
+			p.endLine()
+			text = strings.TrimLeft(text, " \t\r")
+		}
+		if i < len(lines)-1 {
+			text = strings.TrimRight(text, " \t\r")
+		}
+		if text != "" {
+			p.startLine(depth)
+			p.mark(advance(pos, line[:strings.Index(line, text)]))
+			p.write(text)
+		}
+		pos = advance(pos, line+"\n")
+	}
+}
+
+// startLine indents the current line unless it has content already
+func (p *printer) startLine(depth int) {
+	if !p.started {
+		p.indent(depth)
+		p.started = true
+	}
+}
+
+// endLine ends the current line if it has content
+func (p *printer) endLine() {
+	if p.started {
+		p.write("\n")
+		p.started = false
+	}
+}
+
+// printCompact writes a node as Node.String does, recording positions
+func (p *printer) printCompact(node Node) {
+	switch n := node.(type) {
+	case *Document:
+		for _, child := range n.Children {
+			p.printCompact(child)
+		}
+	case *Element:
+		p.mark(n.Pos)
+		p.write(n.openTag())
+		if n.SelfClosing {
+			return
+		}
+		for _, child := range n.Children {
+			p.printCompact(child)
+		}
+		p.mark(n.Pos)
+		p.write("</" + n.TagName + ">")
+	case *TextNode:
+		p.mark(n.Pos)
+		p.write(n.Content)
+	case *CommentNode:
+		p.mark(n.Pos)
+		p.write(n.String())
+	case nil:
+	default:
+		p.write(n.String())
+	}
+}
+
+// verbatim renders a node without changing any of its text
+func (p *printer) verbatim(node Node) string {
+	e, ok := node.(*Element)
+	if !ok {
+		return node.String()
+	}
+	name := p.name(e.SourceName, e.TagName)
+	open := p.openTag(e, name)
+	if e.SelfClosing {
+		return open[:len(open)-1] + " />"
+	}
+	var content strings.Builder
+	for _, child := range e.Children {
+		content.WriteString(p.verbatim(child))
+	}
+	return open + content.String() + "</" + name + ">"
+}
+
+// openTag renders "<name attr="value" ...>"
+func (p *printer) openTag(e *Element, name string) string {
+	var tag strings.Builder
+	tag.WriteString("<")
+	tag.WriteString(name)
+
+	attributes := e.Attributes
+	if p.opts.SortAttributes {
+		attributes = sortedAttributes(attributes)
+	}
+	for _, attr := range attributes {
+		tag.WriteString(" ")
+		tag.WriteString(p.name(attr.SourceName, attr.Name))
+		if attr.Value != "" {
+			tag.WriteString(`="`)
+			tag.WriteString(strings.ReplaceAll(attr.Value, `"`, "&quot;"))
+			tag.WriteString(`"`)
+		}
+	}
+
+	tag.WriteString(">")
+	return tag.String()
+}
+
+// name picks the source or the HTML spelling of a name
+func (p *printer) name(source, html string) string {
+	if p.opts.SourceNames && source != "" {
+		return source
+	}
+	return html
+}
+
+// line writes text on a line of its own; pos is where the text comes from
+func (p *printer) line(depth int, text string, pos Position) {
+	p.indent(depth)
+	p.mark(pos)
+	p.write(text)
+	p.write("\n")
+}
+
+func (p *printer) indent(depth int) {
+	for i := 0; i < depth; i++ {
+		p.write(p.opts.Indent)
+	}
+}
+
+// mark records that the next output comes from pos
+func (p *printer) mark(pos Position) {
+	p.opts.SourceMap.add(p.lineNo, p.column, pos)
+}
+
+// write writes s, keeping track of the output line and column when a source
+// map is being made
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+	if p.opts.SourceMap == nil {
+		return
+	}
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.lineNo += strings.Count(s, "\n")
+		p.column = utf16Length(s[i+1:])
+	} else {
+		p.column += utf16Length(s)
+	}
+}
+
+// mergeText joins adjacent text nodes, as the lexer cuts long text into
+// chunks that belong together
+func mergeText(children []Node) []Node {
+	merged := make([]Node, 0, len(children))
+	for _, child := range children {
+		text, ok := child.(*TextNode)
+		if previous, follows := lastTextNode(merged); ok && follows {
+			merged[len(merged)-1] = &TextNode{Content: previous.Content + text.Content, Pos: previous.Pos}
+			continue
+		}
+		merged = append(merged, child)
+	}
+	return merged
+}
+
+// lastTextNode returns the last node if it is a text node
+func lastTextNode(nodes []Node) (*TextNode, bool) {
+	if len(nodes) == 0 {
+		return nil, false
+	}
+	text, ok := nodes[len(nodes)-1].(*TextNode)
+	return text, ok
+}
+
+// sortedAttributes orders attributes id, class, then alphabetically by HTML name
+func sortedAttributes(attributes []*Attribute) []*Attribute {
+	rank := func(attr *Attribute) int {
+		switch attr.Name {
+		case "id":
+			return 0
+		case "class":
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	sorted := append([]*Attribute(nil), attributes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if ri, rj := rank(sorted[i]), rank(sorted[j]); ri != rj {
+			return ri < rj
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
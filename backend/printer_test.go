@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Text longer than MAX_TOKEN_LENGTH reaches the parser in several chunks,
+// cut wherever the limit falls, even inside a word
+func TestLongTextKeepsItsWords(t *testing.T) {
+	text := strings.TrimSpace(strings.Repeat("abcde ", 500))
+	for _, input := range []string{
+		"<absatz>" + text + "</absatz>",
+		"<abschnitt><absatz>" + text + "</absatz><stark>x</stark></abschnitt>",
+		"<abschnitt>" + strings.Repeat("abcdefg ", 300) + "</abschnitt>", // cut right after a space
+	} {
+		formatted, err := FormatSource(input, NewDictionary())
+		if err != nil {
+			t.Fatal(err)
+		}
+		html, err := NewTranspiler().Transpile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, output := range map[string]string{"fmt": formatted, "transpile": html} {
+			for _, word := range strings.Fields(stripTags(output)) {
+				if word != "abcde" && word != "abcdefg" && word != "x" {
+					t.Errorf("%s: word %q in %.40q...", name, word, output)
+					break
+				}
+			}
+		}
+	}
+}
+
+// stripTags replaces the tags in s with spaces
+func stripTags(s string) string {
+	var out strings.Builder
+	inTag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+			out.WriteRune(' ')
+		case r == '>':
+			inTag = false
+		case !inTag:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// A line break between inline elements and text would add a space to the
+// rendered page, so only block elements get lines of their own
+func TestInlineContentStaysOnOneLine(t *testing.T) {
+	for _, test := range []struct {
+		input, want string
+	}{
+		{
+			"<abschnitt><markdown>\nDas ist **lecker**. Siehe [hier](/x).\n\n- eins **zwei**\n</markdown></abschnitt>",
+			"<section>\n  <p>Das ist <strong>lecker</strong>. Siehe <a href=\"/x\">hier</a>.</p>\n  <ul>\n    <li>eins <strong>zwei</strong></li>\n  </ul>\n</section>\n",
+		},
+		{
+			"<abschnitt>vor<stark>a</stark><absatz>x</absatz>nach</abschnitt>",
+			"<section>\n  vor<strong>a</strong>\n  <p>x</p>\n  nach\n</section>\n",
+		},
+		{
+			"<absatz>\n  Eins\n  zwei<stark>drei</stark>\n</absatz>",
+			"<p>\n  Eins\n  zwei<strong>drei</strong>\n</p>\n",
+		},
+	} {
+		transpiler := NewTranspiler()
+		transpiler.SetOutput(MODE_PRETTY, 2)
+		got, err := transpiler.Transpile(test.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%q:\ngot  %q\nwant %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestFormatSourceUsesDictionary(t *testing.T) {
+	dictionary := NewDictionary()
+	dictionary.tags["markierung"] = "mark"
+	input := "<absatz>Text<markierung>wichtig</markierung></absatz>"
+	formatted, err := FormatSource(input, dictionary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := input + "\n"; formatted != want {
+		t.Errorf("got %q, want %q", formatted, want)
+	}
+}
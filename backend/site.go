@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Default layout of a site project, relative to the project directory
+const (
+	SITE_CONTENT_DIR = "inhalt"   // pages, and files copied next to them
+	SITE_LAYOUT_DIR  = "vorlagen" // layouts named in front matter
+	SITE_ASSET_DIR   = "statisch" // copied to the root of the output
+	SITE_OUTPUT_DIR  = "dist"
+	SITE_INDEX_PAGE  = "index"
+	SITEMAP_FILE     = "sitemap.xml"
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+// Front matter keys for site pages
+var (
+	frontMatterNavigation = []string{"menü", "menu"} // false keeps a page out of the navigation
+	frontMatterOrder      = []string{"reihenfolge", "order"}
+)
+
+// SiteConfig is the "site" section of doner.json. Paths are relative to the
+// project directory.
+type SiteConfig struct {
+	Content string `json:"content,omitempty"`
+	Layouts string `json:"layouts,omitempty"`
+	Layout  string `json:"layout,omitempty"` // default layout, in the layouts directory
+	Assets  string `json:"assets,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Title   string `json:"title,omitempty"`
+	URL     string `json:"url,omitempty"` // where the site is published; needed for sitemap.xml
+}
+
+// Site builds a project directory into a static site: every page in the
+// content directory becomes dir/index.html for a pretty URL, wrapped in its
+// layout and given the site navigation; other files are copied.
+type Site struct {
+	Dir        string
+	Config     SiteConfig
+	Transpiler *Transpiler
+	CheckLinks bool // report links to files missing from the output
+}
+
+// SitePage is a page of a site
+type SitePage struct {
+	Source   string // relative to the content directory
+	Output   string // relative to the output directory
+	URL      string // path on the site, e.g. /ueber-uns/
+	Title    string
+	Order    float64
+	Hidden   bool // not in the navigation
+	Modified time.Time
+
+	content string
+}
+
+// SiteReport is a BuildReport with the site's pages
+type SiteReport struct {
+	BuildReport
+	SitePages []*SitePage
+	Sitemap   string // output path of sitemap.xml, empty when not written
+}
+
+// dir resolves a configured directory against the project directory
+func (s *Site) dir(configured, fallback string) string {
+	if configured == "" {
+		configured = fallback
+	}
+	if filepath.IsAbs(configured) {
+		return configured
+	}
+	return filepath.Join(s.Dir, configured)
+}
+
+// OutputDir is where the site is written
+func (s *Site) OutputDir() string {
+	return s.dir(s.Config.Output, SITE_OUTPUT_DIR)
+}
+
+// Build writes the whole site. Failing pages are recorded in the report and
+// do not stop the build; the error is only set when the content directory
+// cannot be read.
+func (s *Site) Build() (*SiteReport, error) {
+	start := time.Now()
+	s.Transpiler.SetLayouts(s.dir(s.Config.Layouts, SITE_LAYOUT_DIR), s.Config.Layout)
+	contentDir := s.dir(s.Config.Content, SITE_CONTENT_DIR)
+	assetDir := s.dir(s.Config.Assets, SITE_ASSET_DIR)
+	outputDir, err := filepath.Abs(s.OutputDir())
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := listFiles(contentDir, outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading content directory: %w", err)
+	}
+
+	report := &SiteReport{}
+	outputs := map[string]string{} // output path → source, to catch two pages with the same URL
+	for _, rel := range files {
+		if !isSourceFile(rel) {
+			report.Files = append(report.Files, s.copy(filepath.Join(contentDir, rel), rel, outputDir))
+			continue
+		}
+		page, err := s.readPage(contentDir, rel)
+		if err == nil {
+			if other, taken := outputs[page.Output]; taken {
+				err = fmt.Errorf("%s has the same URL %s as %s", rel, page.URL, other)
+			}
+		}
+		if err != nil {
+			report.Files = append(report.Files, BuildFile{Source: rel, Err: err})
+			continue
+		}
+		outputs[page.Output] = rel
+		report.SitePages = append(report.SitePages, page)
+	}
+
+	navigation := siteNavigation(report.SitePages)
+	for _, page := range report.SitePages {
+		report.Files = append(report.Files, s.buildPage(contentDir, outputDir, page, navigation))
+	}
+
+	// Assets go to the root of the output, after the content so they win
+	if info, err := os.Stat(assetDir); err == nil && info.IsDir() {
+		assets, err := listFiles(assetDir, outputDir)
+		if err != nil {
+			return nil, fmt.Errorf("reading asset directory: %w", err)
+		}
+		for _, rel := range assets {
+			report.Files = append(report.Files, s.copy(filepath.Join(assetDir, rel), rel, outputDir))
+		}
+	}
+
+	if s.Config.URL != "" {
+		if err := s.writeSitemap(outputDir, report.SitePages); err != nil {
+			report.Files = append(report.Files, BuildFile{Source: SITEMAP_FILE, Output: SITEMAP_FILE, Err: err})
+		} else {
+			report.Sitemap = SITEMAP_FILE
+		}
+	}
+
+	sort.SliceStable(report.Files, func(i, j int) bool {
+		return report.Files[i].Source < report.Files[j].Source
+	})
+	if s.CheckLinks {
+		checkLinks(&report.BuildReport, outputDir)
+	}
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+// readPage reads a page's source and front matter
+func (s *Site) readPage(contentDir, rel string) (*SitePage, error) {
+	source := filepath.Join(contentDir, rel)
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	frontMatter, err := ParseFrontMatter(source, string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	urlPath, output := prettyURL(rel)
+	page := &SitePage{Source: rel, Output: output, URL: urlPath, Modified: info.ModTime(), content: string(content)}
+	page.Title, _ = frontMatterValue(frontMatter, frontMatterTitle)
+	if page.Title == "" {
+		page.Title = titleFromPath(rel)
+	}
+	if value, ok := frontMatterValue(frontMatter, frontMatterNavigation); ok {
+		page.Hidden = value == "false" || value == "falsch" || value == "nein"
+	}
+	if value, ok := frontMatterValue(frontMatter, frontMatterOrder); ok {
+		if page.Order, err = strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("%s: %q is not a number", frontMatterOrder[0], value)
+		}
+	}
+	return page, nil
+}
+
+// buildPage transpiles a page with the site variables and writes it
+func (s *Site) buildPage(contentDir, outputDir string, page *SitePage, navigation []interface{}) BuildFile {
+	result := BuildFile{Source: page.Source, Output: page.Output}
+	output := filepath.Join(outputDir, filepath.FromSlash(page.Output))
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		result.Err = err
+		return result
+	}
+
+	variables := Variables{
+		"website":    map[string]interface{}{"titel": s.Config.Title, "url": s.Config.URL},
+		"seite":      map[string]interface{}{"titel": page.Title, "url": page.URL},
+		"navigation": markActive(navigation, page.URL),
+	}
+	transpiled, err := s.Transpiler.withData(variables).TranspileSource(filepath.Join(contentDir, page.Source), page.content)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Diagnostics = transpiled.Diagnostics
+	result.Dependencies = transpiled.Dependencies
+	result.Links = collectLinks(transpiled.Document, filepath.Join(contentDir, page.Source))
+	if result.Err = os.WriteFile(output, []byte(transpiled.HTML), 0644); result.Err == nil && transpiled.SourceMap != nil {
+		result.Err = writeSourceMap(output, transpiled.SourceMap)
+	}
+	return result
+}
+
+// copy copies a file to rel below the output directory
+func (s *Site) copy(source, rel, outputDir string) BuildFile {
+	result := BuildFile{Source: rel, Output: rel, Asset: true}
+	output := filepath.Join(outputDir, rel)
+	if result.Err = os.MkdirAll(filepath.Dir(output), 0755); result.Err == nil {
+		result.Err = copyFile(source, output)
+	}
+	return result
+}
+
+// prettyURL maps a page source to its URL and output file:
+// ueber-uns.dhtml → /ueber-uns/ in ueber-uns/index.html, and
+// blog/index.dhtml → /blog/ in blog/index.html
+func prettyURL(rel string) (string, string) {
+	name := strings.TrimSuffix(filepath.ToSlash(rel), path.Ext(rel))
+	if path.Base(name) == SITE_INDEX_PAGE {
+		name = path.Dir(name)
+	}
+	if name == "." {
+		return "/", SITE_INDEX_PAGE + ".html"
+	}
+	return "/" + name + "/", name + "/" + SITE_INDEX_PAGE + ".html"
+}
+
+// titleFromPath makes a title from a file name: ueber-uns.dhtml → Ueber uns
+func titleFromPath(rel string) string {
+	name := strings.TrimSuffix(filepath.Base(rel), filepath.Ext(rel))
+	if name == SITE_INDEX_PAGE {
+		dir := filepath.Base(filepath.Dir(rel))
+		if dir == "." {
+			return "Startseite"
+		}
+		name = dir
+	}
+	name = strings.NewReplacer("-", " ", "_", " ").Replace(name)
+	first, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(first)) + name[size:]
+}
+
+// siteNavigation lists the pages for the navigation, by order and then by
+// URL, as values for placeholders and loops
+func siteNavigation(pages []*SitePage) []interface{} {
+	var listed []*SitePage
+	for _, page := range pages {
+		if !page.Hidden {
+			listed = append(listed, page)
+		}
+	}
+	sort.SliceStable(listed, func(i, j int) bool {
+		if listed[i].Order != listed[j].Order {
+			return listed[i].Order < listed[j].Order
+		}
+		return listed[i].URL < listed[j].URL
+	})
+
+	navigation := make([]interface{}, len(listed))
+	for i, page := range listed {
+		navigation[i] = map[string]interface{}{"titel": page.Title, "url": page.URL}
+	}
+	return navigation
+}
+
+// markActive copies the navigation with "aktiv" set on the entry for url
+func markActive(navigation []interface{}, url string) []interface{} {
+	marked := make([]interface{}, len(navigation))
+	for i, entry := range navigation {
+		item := Variables(entry.(map[string]interface{})).Merge(nil)
+		item["aktiv"] = item["url"] == url
+		marked[i] = map[string]interface{}(item)
+	}
+	return marked
+}
+
+// sitemap is the XML shape of sitemap.xml
+type sitemap struct {
+	XMLName   xml.Name     `xml:"urlset"`
+	Namespace string       `xml:"xmlns,attr"`
+	URLs      []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Location     string `xml:"loc"`
+	LastModified string `xml:"lastmod"`
+}
+
+// writeSitemap lists every page with its absolute URL in sitemap.xml
+func (s *Site) writeSitemap(outputDir string, pages []*SitePage) error {
+	if base, err := url.Parse(s.Config.URL); err != nil || base.Scheme == "" || base.Host == "" {
+		return fmt.Errorf("site url %q must be absolute, like https://example.com/", s.Config.URL)
+	}
+
+	content := sitemap{Namespace: sitemapNamespace}
+	for _, page := range pages {
+		content.URLs = append(content.URLs, sitemapURL{
+			Location:     strings.TrimSuffix(s.Config.URL, "/") + (&url.URL{Path: page.URL}).EscapedPath(),
+			LastModified: page.Modified.UTC().Format("2006-01-02"),
+		})
+	}
+	sort.Slice(content.URLs, func(i, j int) bool {
+		return content.URLs[i].Location < content.URLs[j].Location
+	})
+
+	data, err := xml.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	return os.WriteFile(filepath.Join(outputDir, SITEMAP_FILE), data, 0644)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SOURCE_MAP_EXTENSION is appended to an output file's name for its source map
+const SOURCE_MAP_EXTENSION = ".map"
+
+// base64Digits are the digits of the base64 VLQs in source map mappings
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// SourceMap links places in generated HTML to the positions in the German
+// sources they came from. The printer records one entry where each element,
+// closing tag and line of text starts. Lines and columns are 0-based, as in
+// version 3 source maps; columns count UTF-16 code units.
+type SourceMap struct {
+	File    string // the generated file, for the "file" field
+	entries []sourceMapEntry
+}
+
+type sourceMapEntry struct {
+	line   int
+	column int
+	pos    Position
+}
+
+// add records that generated line and column come from pos; positions
+// without a line, as for nodes made by transforms, are skipped
+func (m *SourceMap) add(line, column int, pos Position) {
+	if m == nil || !pos.IsValid() {
+		return
+	}
+	m.entries = append(m.entries, sourceMapEntry{line: line, column: column, pos: pos})
+}
+
+// shift moves every entry down by lines, and those on the first line right
+// by columns, for text a filter put in front of the output
+func (m *SourceMap) shift(lines, columns int) {
+	for i := range m.entries {
+		if m.entries[i].line == 0 {
+			m.entries[i].column += columns
+		}
+		m.entries[i].line += lines
+	}
+}
+
+// layoutLine is a piece of text that a layout put on an output line of its
+// own: the bytes from start to end, after indent columns
+type layoutLine struct {
+	start, end int
+	indent     int
+}
+
+// relayout moves entries recorded on text to where a layout put them; lines
+// are the pieces of text in output order, one per output line. Entries in
+// whitespace the layout dropped move to the start of the next piece.
+func (m *SourceMap) relayout(text string, lines []layoutLine) {
+	lineStarts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	entries := m.entries[:0]
+	for _, entry := range m.entries {
+		offset, _ := utf16ByteOffset(text[lineStarts[entry.line]:], entry.column)
+		offset += lineStarts[entry.line]
+		i := sort.Search(len(lines), func(i int) bool { return lines[i].end > offset })
+		if i == len(lines) {
+			continue
+		}
+		line := lines[i]
+		column := line.indent + utf16Length(text[line.start:max(offset, line.start)])
+		entries = append(entries, sourceMapEntry{line: i, column: column, pos: entry.pos})
+	}
+	m.entries = entries
+}
+
+// writeSourceMap writes the map for the HTML file output next to it, as
+// output.map
+func writeSourceMap(output string, m *SourceMap) error {
+	m.File = filepath.Base(output)
+	data, err := m.JSON(filepath.Dir(output))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output+SOURCE_MAP_EXTENSION, append(data, '\n'), 0644)
+}
+
+// sourceMapJSON is the version 3 source map format
+type sourceMapJSON struct {
+	Version  int      `json:"version"`
+	File     string   `json:"file,omitempty"`
+	Sources  []string `json:"sources"`
+	Names    []string `json:"names"`
+	Mappings string   `json:"mappings"`
+}
+
+// JSON encodes the map as a version 3 source map. Source paths are made
+// relative to dir, the directory the map is written to, when possible.
+func (m *SourceMap) JSON(dir string) ([]byte, error) {
+	out := sourceMapJSON{Version: 3, File: m.File, Sources: []string{}, Names: []string{}}
+	sources := map[string]int{}
+
+	var mappings strings.Builder
+	line, previousColumn := 0, 0
+	previousSource, previousLine, previousSourceColumn := 0, 0, 0
+	for i, entry := range m.entries {
+		if i > 0 && entry.line == line {
+			mappings.WriteByte(',')
+		}
+		for ; line < entry.line; line++ {
+			mappings.WriteByte(';')
+			previousColumn = 0
+		}
+
+		source, known := sources[entry.pos.File]
+		if !known {
+			source = len(out.Sources)
+			sources[entry.pos.File] = source
+			out.Sources = append(out.Sources, sourceMapPath(entry.pos.File, dir))
+		}
+
+		writeVLQ(&mappings, entry.column-previousColumn)
+		writeVLQ(&mappings, source-previousSource)
+		writeVLQ(&mappings, entry.pos.Line-1-previousLine)
+		writeVLQ(&mappings, entry.pos.Column-1-previousSourceColumn)
+		previousColumn, previousSource = entry.column, source
+		previousLine, previousSourceColumn = entry.pos.Line-1, entry.pos.Column-1
+	}
+	out.Mappings = mappings.String()
+	return json.MarshalIndent(out, "", "  ")
+}
+
+// sourceMapPath names a source for a map written to dir
+func sourceMapPath(file, dir string) string {
+	if file == "" || file == STDIN_NAME {
+		return STDIN_NAME
+	}
+	if dir != "" {
+		if abs, err := filepath.Abs(file); err == nil {
+			if absDir, err := filepath.Abs(dir); err == nil {
+				if rel, err := filepath.Rel(absDir, abs); err == nil {
+					return filepath.ToSlash(rel)
+				}
+			}
+		}
+	}
+	return filepath.ToSlash(file)
+}
+
+// writeVLQ appends a number as a base64 variable-length quantity: the sign in
+// the lowest bit, then five bits per digit with the sixth marking more digits
+func writeVLQ(out *strings.Builder, n int) {
+	value := n << 1
+	if n < 0 {
+		value = (-n << 1) | 1
+	}
+	for {
+		digit := value & 31
+		value >>= 5
+		if value > 0 {
+			digit |= 32
+		}
+		out.WriteByte(base64Digits[digit])
+		if value == 0 {
+			return
+		}
+	}
+}
+
+// utf16Length is the length of s in UTF-16 code units, the unit of source
+// map columns
+func utf16Length(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2 // surrogate pair
+		} else {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"html"
+	"strings"
+)
+
+// Transform is a pass over the parsed document that may inspect or rewrite it
+type Transform func(doc *Document) error
+
+// StripEventHandlers removes inline event handler attributes (onclick, onload, ...)
+func StripEventHandlers(doc *Document) error {
+	Inspect(doc, func(node Node) bool {
+		if element, ok := node.(*Element); ok {
+			kept := element.Attributes[:0]
+			for _, attr := range element.Attributes {
+				if !strings.HasPrefix(strings.ToLower(attr.Name), "on") {
+					kept = append(kept, attr)
+				}
+			}
+			element.Attributes = kept
+		}
+		return true
+	})
+	return nil
+}
+
+// RewriteLinks returns a transform that passes every href and src value through rewrite
+func RewriteLinks(rewrite func(url string) string) Transform {
+	return func(doc *Document) error {
+		Inspect(doc, func(node Node) bool {
+			if element, ok := node.(*Element); ok {
+				for _, attr := range element.Attributes {
+					if attr.Name == "href" || attr.Name == "src" {
+						attr.Value = rewrite(attr.Value)
+					}
+				}
+			}
+			return true
+		})
+		return nil
+	}
+}
+
+// SetLanguage returns a transform that adds lang to <html> elements that have
+// none. The language is text, as it may come from front matter, and is
+// escaped like the title.
+func SetLanguage(lang string) Transform {
+	return func(doc *Document) error {
+		Inspect(doc, func(node Node) bool {
+			if element, ok := node.(*Element); ok && element.TagName == "html" {
+				if _, exists := element.GetAttribute("lang"); !exists {
+					element.SetAttribute("lang", html.EscapeString(lang))
+				}
+			}
+			return true
+		})
+		return nil
+	}
+}
+
+// setTitle fills an empty <title>, or adds one to a <head> without a title
+func setTitle(doc *Document, title string) {
+	var head, existing *Element
+	Inspect(doc, func(node Node) bool {
+		if element, ok := node.(*Element); ok {
+			switch element.TagName {
+			case "head":
+				if head == nil {
+					head = element
+				}
+			case "title":
+				if existing == nil {
+					existing = element
+				}
+			}
+		}
+		return true
+	})
+
+	text := &TextNode{Content: html.EscapeString(title)}
+	switch {
+	case existing != nil && len(existing.Children) == 0:
+		existing.Children = []Node{text}
+	case existing == nil && head != nil:
+		head.Children = append([]Node{&Element{SourceName: "titel", TagName: "title", Kind: NAME_TRANSLATED, Children: []Node{text}}}, head.Children...)
+	}
+}
@@ -2,54 +2,306 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"path/filepath"
 	"strings"
+	"unicode"
 )
 
-// Transpiler handles the conversion from German HTML to standard HTML
+// Transpiler handles the conversion from German HTML to standard HTML. Once
+// configured it may be used from several goroutines at once.
 type Transpiler struct {
 	dictionary *Dictionary
+	pipeline   *Pipeline
+	checks     []Check
+	mode       OutputMode
+	indent     int
+
+	includeRoot string // when set, includes must stay below this directory
+	noIncludes  bool
+	data        Variables // values for {{ name }} placeholders, below front matter
+	variables   Variables // values for {{ name }} placeholders, above front matter
+
+	components     map[string]*Component // loaded with LoadComponents
+	componentFiles []string              // absolute paths of the files they came from
+	configFiles    []string              // absolute paths of the config, dictionary and data files
+
+	layoutDir     string // when set, front-matter layouts are looked up here
+	defaultLayout string // layout for pages whose front matter names none
+	sourceMaps    bool   // record a source map with every result
+}
+
+// OutputMode selects how the generated HTML is laid out
+type OutputMode int
+
+const (
+	MODE_DEFAULT OutputMode = iota // a line break between adjacent tags, text kept with its tags
+	MODE_PRETTY                    // one element per line, nested elements indented
+	MODE_COMPACT                   // everything on one line, as serialised
+)
+
+// ParseOutputMode parses "default", "pretty" or "compact"
+func ParseOutputMode(name string) (OutputMode, error) {
+	switch name {
+	case "default":
+		return MODE_DEFAULT, nil
+	case "pretty":
+		return MODE_PRETTY, nil
+	case "compact":
+		return MODE_COMPACT, nil
+	default:
+		return MODE_DEFAULT, fmt.Errorf("unknown output mode %q (want default, pretty or compact)", name)
+	}
 }
 
 // NewTranspiler creates a new transpiler instance
 func NewTranspiler() *Transpiler {
 	return &Transpiler{
 		dictionary: NewDictionary(),
+		pipeline:   &Pipeline{},
+		mode:       MODE_DEFAULT,
+		indent:     2,
 	}
 }
 
+// Result is the outcome of transpiling one document
+type Result struct {
+	HTML         string
+	Document     *Document    // the AST after all transforms
+	Diagnostics  []Diagnostic // findings of the registered checks
+	Dependencies []string     // other files read while transpiling, as absolute paths
+	FrontMatter  Variables    // the source's front matter, nil without one
+	SourceMap    *SourceMap   // from the HTML back to the sources, when enabled
+}
+
 // Transpile converts German HTML to standard HTML
 func (t *Transpiler) Transpile(input string) (string, error) {
+	result, err := t.TranspileDocument(input)
+	if err != nil {
+		return "", err
+	}
+	return result.HTML, nil
+}
+
+// TranspileDocument converts German HTML to standard HTML and also returns the
+// final AST and the diagnostics reported by the registered checks
+func (t *Transpiler) TranspileDocument(input string) (*Result, error) {
+	return t.TranspileSource("", input)
+}
+
+// TranspileSource is TranspileDocument for a named source; the name appears
+// in node positions and diagnostics
+func (t *Transpiler) TranspileSource(filename, input string) (*Result, error) {
+	result, err := t.analyze(filename, input)
+	if err != nil {
+		return nil, err
+	}
+	
+	if t.sourceMaps {
+		result.SourceMap = &SourceMap{}
+	}
+	var html strings.Builder
+	if err := t.render(&html, result.Document, result.SourceMap); err != nil {
+		return nil, err
+	}
+	result.HTML = html.String()
+	
+	return result, nil
+}
+
+// TranspileTo reads German HTML from r and writes the HTML to w as it is
+// printed. The returned result has no HTML; it carries the AST and diagnostics.
+func (t *Transpiler) TranspileTo(w io.Writer, filename string, r io.Reader) (*Result, error) {
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	
+	result, err := t.analyze(filename, string(input))
+	if err != nil {
+		return nil, err
+	}
+	
+	if t.sourceMaps {
+		result.SourceMap = &SourceMap{}
+	}
+	if err := t.render(w, result.Document, result.SourceMap); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// analyze runs everything up to serialisation: pre-lex filters, parsing,
+// includes and layouts, components, control elements and interpolation,
+// AST transforms and checks
+func (t *Transpiler) analyze(filename, input string) (*Result, error) {
+	document, frontMatter, err := t.parse(filename, input)
+	if err != nil {
+		return nil, err
+	}
+	
+	// A layout named in the front matter, or the default one, wraps the whole page
+	layout, ok := frontMatterValue(frontMatter, frontMatterLayout)
+	if !ok {
+		layout, ok = t.defaultLayout, t.defaultLayout != ""
+	}
+	if ok && layout != NO_LAYOUT && layout != "none" {
+		pos := Position{File: filename, Line: 1, Column: 1}
+		document.Children = []Node{&Element{
+			SourceName: LAYOUT_TAG,
+			TagName:    LAYOUT_TAG,
+			Attributes: []*Attribute{{SourceName: INCLUDE_ATTRIBUTE, Name: INCLUDE_ATTRIBUTE, Value: t.layoutSource(filename, layout), Pos: pos}},
+			Children:   document.Children,
+			Pos:        pos,
+		}}
+	}
+	
+	// Replace <einbinden> elements with the files they name and merge pages
+	// into their <vorlage> layouts
+	includes := &includeState{}
+	if filename != "" && filename != STDIN_NAME {
+		if abs, err := filepath.Abs(filename); err == nil {
+			includes.stack = []string{abs}
+		}
+	}
+	if err := t.expand(document, filename, includes); err != nil {
+		return nil, err
+	}
+	
+	// Expand components, run <wenn> and <für-jedes> and fill in {{ name }}
+	// placeholders. Front matter overrides the data file; --var and request
+	// variables override both.
+	scope := t.data.Merge(frontMatter).Merge(t.variables)
+	components, err := t.collectComponents(document, t.components)
+	if err != nil {
+		return nil, err
+	}
+	if err := evaluateTemplate(document, scope, components); err != nil {
+		return nil, err
+	}
+	
+	// Fill in <titel> and <html lang> from the front matter
+	if title, ok := frontMatterValue(frontMatter, frontMatterTitle); ok {
+		setTitle(document, title)
+	}
+	if lang, ok := frontMatterValue(frontMatter, frontMatterLanguage); ok {
+		SetLanguage(lang)(document)
+	}
+	
+	// Run AST transforms
+	if err := t.pipeline.runTransforms(document); err != nil {
+		return nil, fmt.Errorf("transform error: %w", err)
+	}
+	
+	// Run checks over the final AST
+	var diagnostics []Diagnostic
+	for _, check := range t.checks {
+		diagnostics = append(diagnostics, check(document)...)
+	}
+	sortDiagnostics(diagnostics)
+	
+	dependencies := append(includes.dependencies, t.ConfigFiles()...)
+	return &Result{Document: document, Diagnostics: diagnostics, Dependencies: dependencies, FrontMatter: frontMatter}, nil
+}
+
+// parse runs the pre-lex filters over a source and parses it and its front matter
+func (t *Transpiler) parse(filename, input string) (*Document, Variables, error) {
+	// Run pre-lex text filters over the source
+	input, err := t.pipeline.runFilters(STAGE_PRE_LEX, input)
+	if err != nil {
+		return nil, nil, fmt.Errorf("filter error: %w", err)
+	}
+	
+	frontMatter, err := ParseFrontMatter(filename, input)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing error: %w", err)
+	}
+	
 	// Create lexer
 	lexer := NewLexer(input)
 	
 	// Create parser
 	parser := NewParser(lexer, t.dictionary)
+	parser.SetFilename(filename)
 	
 	// Parse into AST
 	document, err := parser.Parse()
 	if err != nil {
-		return "", fmt.Errorf("parsing error: %w", err)
+		return nil, nil, fmt.Errorf("parsing error: %w", err)
+	}
+	expandMarkdown(document, t.dictionary)
+	return document, frontMatter, nil
+}
+
+// render serialises the document to w and applies the post-serialise filters.
+// Without such filters the printer streams straight to w, except for
+// MODE_DEFAULT, which lays out the whole HTML. A source map, when given, is
+// filled in as the document is printed.
+func (t *Transpiler) render(w io.Writer, document *Document, sourceMap *SourceMap) error {
+	options := PrintOptions{Indent: strings.Repeat(" ", t.indent), Compact: t.mode == MODE_COMPACT, SourceMap: sourceMap}
+	filters := t.pipeline.Passes(STAGE_POST_SERIALIZE)
+	if len(filters) == 0 && t.mode != MODE_DEFAULT {
+		return Fprint(w, document, options)
+	}
+	
+	// Convert AST back to HTML string. MODE_DEFAULT reformats the compact
+	// HTML, and moves what the source map recorded on it along.
+	var result string
+	switch t.mode {
+	case MODE_PRETTY, MODE_COMPACT:
+		result = Print(document, options)
+	default:
+		options.Compact = true
+		result = t.formatHTML(Print(document, options), sourceMap)
 	}
 	
-	// Convert AST back to HTML string
-	result := document.String()
+	// Run post-serialise text filters over the HTML
+	filtered, err := t.pipeline.runFilters(STAGE_POST_SERIALIZE, result)
+	if err != nil {
+		return fmt.Errorf("filter error: %w", err)
+	}
+	
+	// Filters that only add text in front, like the doctype, shift the map;
+	// after others it no longer fits
+	if sourceMap != nil {
+		if prefix, ok := strings.CutSuffix(filtered, result); ok {
+			sourceMap.shift(strings.Count(prefix, "\n"), utf16Length(prefix[strings.LastIndexByte(prefix, '\n')+1:]))
+		} else {
+			sourceMap.entries = nil
+		}
+	}
 	
-	// Pretty print the result
-	return t.formatHTML(result), nil
+	_, err = io.WriteString(w, filtered)
+	return err
 }
 
-// formatHTML provides basic formatting for the HTML output
-func (t *Transpiler) formatHTML(html string) string {
-	// First, clean up the HTML and add newlines between tags
-	html = strings.ReplaceAll(html, "><", ">\n<")
+// formatHTML provides basic formatting for the HTML output. Entries of
+// sourceMap, when given, were recorded on html and are moved to where their
+// text ends up.
+func (t *Transpiler) formatHTML(html string, sourceMap *SourceMap) string {
+	// Split into lines at newlines and between tags, keeping each line's
+	// place in html for the source map
+	var lines []layoutLine
+	start := 0
+	for i := 0; i <= len(html); i++ {
+		if i == len(html) || html[i] == '\n' || (i > 0 && html[i-1] == '>' && html[i] == '<') {
+			lines = append(lines, layoutLine{start: start, end: i})
+			start = i
+			if i < len(html) && html[i] == '\n' {
+				start++
+			}
+		}
+	}
 	
-	// Split into lines and process each line
-	lines := strings.Split(html, "\n")
 	var formatted strings.Builder
+	var placed []layoutLine
 	indent := 0
 	
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
+	for _, span := range lines {
+		line := strings.TrimLeftFunc(html[span.start:span.end], unicode.IsSpace)
+		span.start = span.end - len(line)
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		span.end = span.start + len(line)
 		if line == "" {
 			continue
 		}
@@ -74,6 +326,8 @@ func (t *Transpiler) formatHTML(html string) string {
 		}
 		formatted.WriteString(line)
 		formatted.WriteString("\n")
+		span.indent = 2 * indent
+		placed = append(placed, span)
 		
 		// For opening tags (that are not self-closing), increase indent after printing
 		if strings.HasPrefix(line, "<") && !isClosingTag && !isSelfClosing {
@@ -81,9 +335,162 @@ func (t *Transpiler) formatHTML(html string) string {
 		}
 	}
 	
+	if sourceMap != nil {
+		sourceMap.relayout(html, placed)
+	}
 	return formatted.String()
 }
 
+// SetOutput sets the output layout and, for MODE_PRETTY, the indentation width in spaces
+func (t *Transpiler) SetOutput(mode OutputMode, indent int) {
+	t.mode = mode
+	t.indent = indent
+}
+
+// SetIncludeRoot restricts includes to files below root
+func (t *Transpiler) SetIncludeRoot(root string) {
+	t.includeRoot = root
+}
+
+// DisableIncludes makes every include directive an error, for sources that
+// must not read files
+func (t *Transpiler) DisableIncludes() {
+	t.noIncludes = true
+}
+
+// AddVariables sets values for {{ name }} placeholders, replacing earlier
+// values of the same names. They take precedence over front matter.
+func (t *Transpiler) AddVariables(variables Variables) {
+	t.variables = t.variables.Merge(variables)
+}
+
+// AddData sets default values for {{ name }} placeholders, as read from a
+// data file; front matter and AddVariables override them
+func (t *Transpiler) AddData(data Variables) {
+	t.data = t.data.Merge(data)
+}
+
+// SetLayouts makes layouts named in front matter resolve in dir rather than
+// next to the page, and wraps pages whose front matter names no layout in
+// defaultLayout, unless it is empty. "vorlage: keine" opts a page out.
+func (t *Transpiler) SetLayouts(dir, defaultLayout string) {
+	t.layoutDir = dir
+	t.defaultLayout = defaultLayout
+}
+
+// layoutSource turns a front-matter layout name into a path relative to the
+// page, as <vorlage quelle> expects
+func (t *Transpiler) layoutSource(filename, layout string) string {
+	if t.layoutDir == "" {
+		return layout
+	}
+	dir := t.includeRoot
+	if filename != "" && filename != STDIN_NAME {
+		dir = filepath.Dir(filename)
+	}
+	rel, err := filepath.Rel(dir, filepath.Join(t.layoutDir, filepath.FromSlash(layout)))
+	if err != nil {
+		return layout
+	}
+	return filepath.ToSlash(rel)
+}
+
+// EnableSourceMaps makes every result carry a source map from its HTML back
+// to the German sources
+func (t *Transpiler) EnableSourceMaps() {
+	t.sourceMaps = true
+}
+
+// withData returns a copy of the transpiler with extra default values for
+// placeholders, for per-page values in a shared configuration
+func (t *Transpiler) withData(data Variables) *Transpiler {
+	copied := t.clone()
+	copied.data = t.data.Merge(data)
+	return copied
+}
+
+// clone returns a copy that can be configured further without changing t,
+// such as a transpiler per request made from one loaded at startup. The copy
+// shares the pipeline, the dictionary and the components.
+func (t *Transpiler) clone() *Transpiler {
+	copied := *t
+	copied.checks = t.checks[:len(t.checks):len(t.checks)] // AddCheck on the copy must not write into t's array
+	return &copied
+}
+
+// ConfigFiles returns the absolute paths of the files the transpiler was set
+// up from: config, dictionary, data and component files. Every page depends
+// on them; when one changes, the transpiler has to be set up again.
+func (t *Transpiler) ConfigFiles() []string {
+	return append(append([]string(nil), t.configFiles...), t.componentFiles...)
+}
+
+// addConfigFile records a file the transpiler was set up from
+func (t *Transpiler) addConfigFile(path string) {
+	if path == "" {
+		return
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	t.configFiles = append(t.configFiles, path)
+}
+
+// SetDictionary replaces the dictionary used to translate names
+func (t *Transpiler) SetDictionary(dictionary *Dictionary) {
+	t.dictionary = dictionary
+}
+
+// Dictionary returns the dictionary used to translate names
+func (t *Transpiler) Dictionary() *Dictionary {
+	return t.dictionary
+}
+
+// AddCheck registers checks that run on every document after the AST transforms
+func (t *Transpiler) AddCheck(checks ...Check) {
+	t.checks = append(t.checks, checks...)
+}
+
+// AddTransform registers unnamed AST passes that run, in order, on every
+// parsed document; nil transforms are skipped
+func (t *Transpiler) AddTransform(transforms ...Transform) {
+	for _, transform := range transforms {
+		if transform == nil {
+			continue
+		}
+		// Pick the first free name, as passes may have been removed
+		n := len(t.pipeline.passes) + 1
+		for t.pipeline.Has(fmt.Sprintf("transform-%d", n)) {
+			n++
+		}
+		t.pipeline.mustAdd(Pass{Name: fmt.Sprintf("transform-%d", n), Stage: STAGE_AST, Transform: transform})
+	}
+}
+
+// AddPass registers a custom pass on this transpiler
+func (t *Transpiler) AddPass(pass Pass) error {
+	return t.pipeline.Add(pass)
+}
+
+// EnablePasses enables registered passes by name
+func (t *Transpiler) EnablePasses(names ...string) error {
+	for _, name := range names {
+		pass, exists := LookupPass(name)
+		if !exists {
+			return fmt.Errorf("unknown pass %q (available: %s)", name, strings.Join(AvailablePasses(), ", "))
+		}
+		if err := t.pipeline.Add(pass); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pipeline returns the transpiler's pass pipeline
+func (t *Transpiler) Pipeline() *Pipeline {
+	return t.pipeline
+}
+
 // GetSupportedTags returns a map of supported German tags to HTML tags
 func (t *Transpiler) GetSupportedTags() map[string]string {
 	return t.dictionary.tags
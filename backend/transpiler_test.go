@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutputModes(t *testing.T) {
+	input := "<abschnitt><absatz>Hallo<fett>Welt</fett>!</absatz></abschnitt>"
+	for mode, want := range map[OutputMode]string{
+		MODE_DEFAULT: "<section>\n  <p>Hallo<b>Welt</b>!</p>\n</section>\n",
+		MODE_COMPACT: "<section><p>Hallo<b>Welt</b>!</p></section>",
+	} {
+		transpiler := NewTranspiler()
+		transpiler.SetOutput(mode, 2)
+		got, err := transpiler.Transpile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("mode %d: got %q, want %q", mode, got, want)
+		}
+	}
+}
+
+func TestCloneKeepsChecksApart(t *testing.T) {
+	var ran []string
+	check := func(name string) Check {
+		return func(*Document) []Diagnostic {
+			ran = append(ran, name)
+			return nil
+		}
+	}
+	base := NewTranspiler()
+	for i := 0; i < 3; i++ { // leaves room in the slice for one more
+		base.AddCheck(check("base"))
+	}
+	first, second := base.clone(), base.clone()
+	first.AddCheck(check("first"))
+	second.AddCheck(check("second"))
+
+	if _, err := first.Transpile("<absatz>x</absatz>"); err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 4 || ran[3] != "first" {
+		t.Errorf("first copy ran %v", ran)
+	}
+	if len(base.checks) != 3 {
+		t.Errorf("base has %d checks, want 3", len(base.checks))
+	}
+}
+
+// A source map describes the HTML as it is written without one, and each
+// entry points at output that starts like the source it names
+func TestSourceMapsDescribeTheNormalOutput(t *testing.T) {
+	input := "<html><körper><abschnitt>\n  Text vor\n  <absatz>Hallo <stark>Wält</stark>, wie\n  geht's? 😀</absatz>\n" +
+		"  <bild quelle=\"a.png\"/>\n</abschnitt></körper></html>"
+	source := []rune(input)
+	for _, mode := range []OutputMode{MODE_DEFAULT, MODE_PRETTY, MODE_COMPACT} {
+		for _, passes := range [][]string{nil, {"doctype"}} {
+			plain := NewTranspiler()
+			plain.SetOutput(mode, 2)
+			plain.EnablePasses(passes...)
+			want, err := plain.Transpile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mapped := NewTranspiler()
+			mapped.SetOutput(mode, 2)
+			mapped.EnablePasses(passes...)
+			mapped.EnableSourceMaps()
+			result, err := mapped.TranspileDocument(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.HTML != want {
+				t.Errorf("mode %d %v: with a source map got\n%s\nwithout\n%s", mode, passes, result.HTML, want)
+			}
+			if len(result.SourceMap.entries) < 10 {
+				t.Fatalf("mode %d %v: only %d entries", mode, passes, len(result.SourceMap.entries))
+			}
+
+			lines := strings.Split(result.HTML, "\n")
+			for _, entry := range result.SourceMap.entries {
+				offset, ok := utf16ByteOffset(lines[entry.line], entry.column)
+				output := lines[entry.line][offset:]
+				if !ok || output == "" {
+					t.Errorf("mode %d %v: entry %d:%d is past the end of its line", mode, passes, entry.line, entry.column)
+					continue
+				}
+				from := source[entry.pos.Offset]
+				if (from == '<') != (output[0] == '<') || (from != '<' && !strings.HasPrefix(output, string(from))) {
+					t.Errorf("mode %d %v: %q at %d:%d maps to %q", mode, passes, output, entry.line, entry.column, string(source[entry.pos.Offset:]))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Variables are the values {{ name }} placeholders are replaced with. Values
+// come from JSON, so they may be strings, numbers, booleans, lists or nested
+// objects; nested values are reached with dots, as in {{ autor.name }}.
+type Variables map[string]interface{}
+
+// placeholderPattern matches {{ name }} and {{ name.feld }}
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([\p{L}\p{N}_-]+(?:\.[\p{L}\p{N}_-]+)*)\s*\}\}`)
+
+// interpolationPattern matches placeholders and \{{, which stands for a
+// literal {{ that is not filled in
+var interpolationPattern = regexp.MustCompile(`\\\{\{|` + placeholderPattern.String())
+
+// LoadVariablesFile reads variables from a JSON file holding an object
+func LoadVariablesFile(path string) (Variables, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var variables Variables
+	if err := json.Unmarshal(data, &variables); err != nil {
+		return nil, fmt.Errorf("invalid data file %s: %w", path, err)
+	}
+	return variables, nil
+}
+
+// ParseVariable splits a "name=value" assignment as given to --var
+func ParseVariable(assignment string) (string, string, error) {
+	name, value, found := strings.Cut(assignment, "=")
+	if !found || strings.TrimSpace(name) == "" {
+		return "", "", fmt.Errorf("invalid variable %q (want name=value)", assignment)
+	}
+	return strings.TrimSpace(name), value, nil
+}
+
+// Merge returns the variables of v overridden by those of other
+func (v Variables) Merge(other Variables) Variables {
+	merged := make(Variables, len(v)+len(other))
+	for name, value := range v {
+		merged[name] = value
+	}
+	for name, value := range other {
+		merged[name] = value
+	}
+	return merged
+}
+
+// Lookup returns the value of a name, following dots into nested objects
+func (v Variables) Lookup(name string) (interface{}, bool) {
+	var value interface{} = map[string]interface{}(v)
+	for _, part := range strings.Split(name, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// formatValue turns a variable value into text
+func formatValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case []interface{}:
+		return "", fmt.Errorf("is a list")
+	case map[string]interface{}:
+		return "", fmt.Errorf("is an object")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// interpolate replaces the placeholders in s with their HTML-escaped values
+// and \{{ with {{. pos is where s starts in the source and is used for errors.
+func interpolate(s string, variables Variables, pos Position) (string, error) {
+	matches := interpolationPattern.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s, nil
+	}
+
+	var result strings.Builder
+	last := 0
+	for _, match := range matches {
+		if match[2] < 0 {
+			result.WriteString(s[last:match[0]])
+			result.WriteString("{{")
+			last = match[1]
+			continue
+		}
+		name := s[match[2]:match[3]]
+		value, found := variables.Lookup(name)
+		if !found {
+			return "", &SyntaxError{Pos: advance(pos, s[:match[0]]), Message: fmt.Sprintf("undefined variable %q", name)}
+		}
+		text, err := formatValue(value)
+		if err != nil {
+			return "", &SyntaxError{Pos: advance(pos, s[:match[0]]), Message: fmt.Sprintf("variable %q %v and cannot be inserted", name, err)}
+		}
+		result.WriteString(s[last:match[0]])
+		result.WriteString(html.EscapeString(text))
+		last = match[1]
+	}
+	result.WriteString(s[last:])
+	return result.String(), nil
+}
+
+// advance moves a position past the given text
+func advance(pos Position, text string) Position {
+	if !pos.IsValid() {
+		return pos
+	}
+	for _, r := range text {
+		pos.Offset++
+		if r == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	return pos
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	variables := Variables{"name": "Ali & Co", "autor": map[string]interface{}{"name": "Aylin"}}
+	for _, test := range []struct {
+		input, want string
+	}{
+		{"Hallo {{ name }}", "Hallo Ali &amp; Co"},
+		{"{{autor.name}}", "Aylin"},
+		{`\{{ name }}`, "{{ name }}"},
+		{`\{{ nicht definiert }} {{ name }}`, "{{ nicht definiert }} Ali &amp; Co"},
+		{"{ name } {{ }}", "{ name } {{ }}"},
+	} {
+		got, err := interpolate(test.input, variables, Position{Line: 1, Column: 1})
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: got %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestInterpolationErrorPositions(t *testing.T) {
+	for _, test := range []struct {
+		input        string
+		line, column int
+	}{
+		{"<absatz>ab {{ x }}</absatz>", 1, 12},
+		{`<absatz titel="ab {{ x }}"/>`, 1, 19},
+		{"<absatz titel='{{ x }}'/>", 1, 16},
+		{"<absatz titel=\"a\nb {{ x }}\"/>", 2, 3},
+		{"<absatz>" + strings.Repeat("a", 995) + " {{ x }}</absatz>", 1, 1005}, // after a lexer chunk
+	} {
+		_, err := NewTranspiler().Transpile(test.input)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%q: got %v, want an undefined variable error", test.input, err)
+			continue
+		}
+		if syntaxErr.Pos.Line != test.line || syntaxErr.Pos.Column != test.column {
+			t.Errorf("%q: error at %d:%d, want %d:%d", test.input, syntaxErr.Pos.Line, syntaxErr.Pos.Column, test.line, test.column)
+		}
+	}
+}
+
+// Text longer than MAX_TOKEN_LENGTH reaches the template in chunks; a
+// placeholder across a cut must still be filled in
+func TestPlaceholderAcrossLexerChunks(t *testing.T) {
+	transpiler := NewTranspiler()
+	transpiler.AddVariables(Variables{"name": "Aylin"})
+	for n := 985; n <= 1000; n++ {
+		text := strings.Repeat("a", n)
+		got, err := transpiler.Transpile("<absatz>" + text + " {{ name }} ende</absatz>")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, text+" Aylin ende") {
+			t.Errorf("%d characters before the placeholder: got %.40q...", n, got[len(got)-40:])
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+// Visitor is implemented by anything that wants to be called for each node
+// reached by Walk. If Visit returns a non-nil visitor w, Walk visits the
+// children of node with w and finishes with a call to w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node in depth-first order
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	for _, child := range childrenOf(node) {
+		Walk(v, child)
+	}
+
+	v.Visit(nil)
+}
+
+// inspector adapts a plain function to the Visitor interface
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node, calling f for every node.
+// Children are only visited while f returns true; f(nil) is called after
+// the children of a node have been visited.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// RewriteFunc returns the replacement for a node. Returning the node itself
+// keeps it, returning nil removes it, and returning a *Document splices the
+// document's children in place of the node.
+type RewriteFunc func(Node) Node
+
+// Rewrite rebuilds the tree rooted at node bottom-up, so f always sees a node
+// whose children have already been rewritten. The (possibly replaced) root is
+// returned; the root itself cannot be spliced or removed by its parent.
+func Rewrite(node Node, f RewriteFunc) Node {
+	if children := childrenOf(node); children != nil {
+		var rewritten []Node
+		for _, child := range children {
+			replacement := Rewrite(child, f)
+			switch r := replacement.(type) {
+			case nil:
+				// removed
+			case *Document:
+				rewritten = append(rewritten, r.Children...)
+			default:
+				rewritten = append(rewritten, r)
+			}
+		}
+		setChildrenOf(node, rewritten)
+	}
+
+	return f(node)
+}
+
+// childrenOf returns the child nodes of container nodes and nil for leaves
+func childrenOf(node Node) []Node {
+	switch n := node.(type) {
+	case *Document:
+		return n.Children
+	case *Element:
+		return n.Children
+	default:
+		return nil
+	}
+}
+
+// setChildrenOf replaces the child nodes of a container node
+func setChildrenOf(node Node, children []Node) {
+	if children == nil {
+		children = []Node{}
+	}
+	switch n := node.(type) {
+	case *Document:
+		n.Children = children
+	case *Element:
+		n.Children = children
+	}
+}
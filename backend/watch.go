@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DEFAULT_WATCH_INTERVAL is how often watch mode polls the source tree
+const DEFAULT_WATCH_INTERVAL = 500 * time.Millisecond
+
+// fileStamp identifies a version of a file by modification time and size
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshot maps paths to the stamp they had when the snapshot was taken
+type snapshot map[string]fileStamp
+
+// takeSnapshot stamps the given paths relative to dir; files that vanish
+// between listing and stat are left out
+func takeSnapshot(dir string, files []string) snapshot {
+	snap := make(snapshot, len(files))
+	for _, rel := range files {
+		if info, err := os.Stat(filepath.Join(dir, rel)); err == nil {
+			snap[rel] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return snap
+}
+
+// diffSnapshots returns the paths that are new or changed in next and the
+// paths that are gone, both sorted
+func diffSnapshots(previous, next snapshot) (changed, removed []string) {
+	for path, stamp := range next {
+		if old, exists := previous[path]; !exists || old != stamp {
+			changed = append(changed, path)
+		}
+	}
+	for path := range previous {
+		if _, exists := next[path]; !exists {
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// dependencyGraph records which pages read which other files
+type dependencyGraph struct {
+	mutex      sync.Mutex
+	deps       map[string][]string        // page → absolute dependency paths
+	dependents map[string]map[string]bool // absolute dependency path → pages
+}
+
+func newDependencyGraph() *dependencyGraph {
+	return &dependencyGraph{
+		deps:       make(map[string][]string),
+		dependents: make(map[string]map[string]bool),
+	}
+}
+
+// update replaces the recorded dependencies of a page
+func (g *dependencyGraph) update(page string, deps []string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for _, dep := range g.deps[page] {
+		delete(g.dependents[dep], page)
+	}
+	g.deps[page] = deps
+	for _, dep := range deps {
+		if g.dependents[dep] == nil {
+			g.dependents[dep] = make(map[string]bool)
+		}
+		g.dependents[dep][page] = true
+	}
+}
+
+// paths returns every recorded dependency, sorted
+func (g *dependencyGraph) paths() []string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	paths := make([]string, 0, len(g.dependents))
+	for path, pages := range g.dependents {
+		if len(pages) > 0 {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// remove forgets a page
+func (g *dependencyGraph) remove(page string) {
+	g.update(page, nil)
+	g.mutex.Lock()
+	delete(g.deps, page)
+	g.mutex.Unlock()
+}
+
+// dependentsOf returns the pages that read the given absolute path. Pages
+// record everything they read, including nested includes, so this is direct.
+func (g *dependencyGraph) dependentsOf(path string) []string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	pages := make([]string, 0, len(g.dependents[path]))
+	for page := range g.dependents[path] {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+	return pages
+}
+
+// Watch builds the source tree, then polls it every interval and rebuilds
+// changed files and the pages that depend on them until stop is closed.
+// Dependencies outside the tree, like layouts and the config, data and
+// component files, are polled too; a change to the transpiler's own files
+// reloads it through Reload first. Outputs of removed files are deleted.
+// Every build is passed to onBuild; build errors never end the watch.
+func (b *Builder) Watch(interval time.Duration, stop <-chan struct{}, onBuild func(*BuildReport)) error {
+	files, err := b.sourceFiles()
+	if err != nil {
+		return err
+	}
+	current := takeSnapshot(b.SourceDir, files)
+	onBuild(b.BuildFiles(files))
+	watchList := b.watchedPaths()
+	watched := takeSnapshot("", watchList)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+
+		files, err := b.sourceFiles()
+		if err != nil {
+			// The tree may be mid-rename; try again on the next tick
+			continue
+		}
+		next := takeSnapshot(b.SourceDir, files)
+		changed, removed := diffSnapshots(current, next)
+		current = next
+		nextWatched := takeSnapshot("", watchList)
+		changedDeps, removedDeps := diffSnapshots(watched, nextWatched)
+		watched = nextWatched
+		if len(changed) == 0 && len(removed) == 0 && len(changedDeps) == 0 && len(removedDeps) == 0 {
+			continue
+		}
+
+		for _, rel := range removed {
+			output := filepath.Join(b.OutputDir, b.outputName(rel))
+			os.Remove(output)
+			if isSourceFile(rel) {
+				os.Remove(output + SOURCE_MAP_EXTENSION)
+			}
+			b.graph.remove(rel)
+		}
+
+		// Every file that changed or went away, as absolute paths
+		touched := append(changedDeps, removedDeps...)
+		for _, rel := range append(changed, removed...) {
+			if abs, err := filepath.Abs(filepath.Join(b.SourceDir, rel)); err == nil {
+				touched = append(touched, abs)
+			}
+		}
+		if err := b.reloadIfConfigChanged(touched); err != nil {
+			onBuild(&BuildReport{Files: []BuildFile{{Source: touched[0], Err: err}}})
+			continue
+		}
+
+		// Rebuild what changed plus every page that read a changed or removed file
+		rebuild := map[string]bool{}
+		for _, rel := range changed {
+			rebuild[rel] = true
+		}
+		for _, abs := range touched {
+			for _, page := range b.graph.dependentsOf(abs) {
+				if _, exists := next[page]; exists {
+					rebuild[page] = true
+				}
+			}
+		}
+
+		var targets []string
+		for rel := range rebuild {
+			targets = append(targets, rel)
+		}
+		sort.Strings(targets)
+		onBuild(b.BuildFiles(targets))
+		watchList = b.watchedPaths()
+		watched = takeSnapshot("", watchList)
+	}
+}
+
+// watchedPaths returns the files outside the source listing that the build
+// depends on: the recorded dependencies and the transpiler's own files
+func (b *Builder) watchedPaths() []string {
+	return append(b.graph.paths(), b.Transpiler.ConfigFiles()...)
+}
+
+// reloadIfConfigChanged sets the transpiler up again through Reload when one
+// of the touched paths is among its ConfigFiles
+func (b *Builder) reloadIfConfigChanged(touched []string) error {
+	if b.Reload == nil {
+		return nil
+	}
+	configFiles := b.Transpiler.ConfigFiles()
+	for _, path := range touched {
+		if !slices.Contains(configFiles, path) {
+			continue
+		}
+		transpiler, err := b.Reload()
+		if err != nil {
+			return fmt.Errorf("reloading after %s changed: %w", path, err)
+		}
+		b.Transpiler = transpiler
+		return nil
+	}
+	return nil
+}
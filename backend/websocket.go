@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// websocketGUID is appended to the client's key for the accept header (RFC 6455, 1.3)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// WebSocket close codes
+const (
+	WS_CLOSE_NORMAL       = 1000
+	WS_CLOSE_GOING_AWAY   = 1001
+	WS_CLOSE_PROTOCOL     = 1002
+	WS_CLOSE_UNSUPPORTED  = 1003
+	WS_CLOSE_INVALID_DATA = 1007
+	WS_CLOSE_TOO_BIG      = 1009
+	WS_CLOSE_INTERNAL     = 1011
+)
+
+// wsCloseError is returned by ReadMessage when the connection is closed; Code
+// is the close code the peer sent, or the one we closed with
+type wsCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *wsCloseError) Error() string {
+	return fmt.Sprintf("websocket closed (%d %s)", e.Code, e.Reason)
+}
+
+// wsConn is the server side of a WebSocket connection. Reads happen on one
+// goroutine; writes may come from several.
+type wsConn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	maxMessage int // longest message accepted, in bytes
+
+	writeMutex sync.Mutex
+	closed     bool
+}
+
+// upgradeWebSocket answers the opening handshake of a WebSocket request and
+// takes over its connection. On failure it has written an HTTP error.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, maxMessage int) (*wsConn, error) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil, errors.New("websocket handshake must use GET")
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("not a websocket upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("invalid websocket key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, errors.New("connection cannot be taken over")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, reader: buffered.Reader, maxMessage: maxMessage}, nil
+}
+
+// headerHasToken reports whether a comma-separated header contains token,
+// ignoring case
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message, joining fragments.
+// Pings are answered while waiting; a close frame is answered and returned
+// as a *wsCloseError. Protocol violations close the connection.
+func (c *wsConn) ReadMessage(timeout time.Duration) (int, []byte, error) {
+	var message []byte
+	opcode := -1
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(timeout))
+		fin, frameOpcode, payload, err := c.readFrame()
+		if err != nil {
+			var closeErr *wsCloseError
+			if errors.As(err, &closeErr) {
+				c.Close(closeErr.Code, closeErr.Reason)
+			}
+			return 0, nil, err
+		}
+
+		switch frameOpcode {
+		case wsPing:
+			if err := c.write(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+		case wsPong:
+			// Answers our keepalive pings; reading it extended the deadline
+		case wsClose:
+			code, reason := WS_CLOSE_NORMAL, ""
+			if len(payload) >= 2 {
+				code, reason = int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+			}
+			c.Close(code, "")
+			return 0, nil, &wsCloseError{Code: code, Reason: reason}
+		case wsText, wsBinary, wsContinuation:
+			if (frameOpcode == wsContinuation) != (opcode >= 0) {
+				return 0, nil, c.fail(WS_CLOSE_PROTOCOL, "unexpected continuation frame")
+			}
+			if opcode < 0 {
+				opcode = frameOpcode
+			}
+			if len(message)+len(payload) > c.maxMessage {
+				return 0, nil, c.fail(WS_CLOSE_TOO_BIG, "message too big")
+			}
+			message = append(message, payload...)
+			if !fin {
+				continue
+			}
+			if opcode == wsText && !utf8.Valid(message) {
+				return 0, nil, c.fail(WS_CLOSE_INVALID_DATA, "text message is not UTF-8")
+			}
+			return opcode, message, nil
+		default:
+			return 0, nil, c.fail(WS_CLOSE_PROTOCOL, "unknown opcode")
+		}
+	}
+}
+
+// readFrame reads and unmasks one frame
+func (c *wsConn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &wsCloseError{Code: WS_CLOSE_PROTOCOL, Reason: "reserved bits set"}
+	}
+	if !masked {
+		return false, 0, nil, &wsCloseError{Code: WS_CLOSE_PROTOCOL, Reason: "client frames must be masked"}
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if opcode >= wsClose && (!fin || length > 125) {
+		return false, 0, nil, &wsCloseError{Code: WS_CLOSE_PROTOCOL, Reason: "invalid control frame"}
+	}
+	if length > uint64(c.maxMessage) {
+		return false, 0, nil, &wsCloseError{Code: WS_CLOSE_TOO_BIG, Reason: "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteText sends a text message
+func (c *wsConn) WriteText(data []byte) error {
+	return c.write(wsText, data)
+}
+
+// Ping sends a ping; the pong extends the read deadline
+func (c *wsConn) Ping() error {
+	return c.write(wsPing, nil)
+}
+
+// write sends one unfragmented, unmasked frame
+func (c *wsConn) write(opcode int, payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	return c.writeFrame(opcode, payload)
+}
+
+func (c *wsConn) writeFrame(opcode int, payload []byte) error {
+	header := []byte{0x80 | byte(opcode)}
+	switch length := len(payload); {
+	case length <= 125:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// fail closes the connection for a protocol violation and returns the error
+func (c *wsConn) fail(code int, reason string) error {
+	c.Close(code, reason)
+	return &wsCloseError{Code: code, Reason: reason}
+}
+
+// Close sends a close frame, once, and closes the connection
+func (c *wsConn) Close(code int, reason string) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	c.writeFrame(wsClose, append(payload, reason...))
+	c.conn.Close()
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsTestClient is a raw WebSocket client that writes frames byte by byte
+type wsTestClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialWebSocket opens a WebSocket to server and checks the handshake
+func dialWebSocket(t *testing.T, server *httptest.Server) *wsTestClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := "GET / HTTP/1.1\r\n" +
+		"Host: " + server.Listener.Addr().String() + "\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"
+	if _, err := conn.Write([]byte(request)); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The accept value for this key is given in RFC 6455, 1.3
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake: got %s %v", response.Status, response.Header)
+	}
+	return &wsTestClient{t: t, conn: conn, reader: reader}
+}
+
+// writeFrame sends one frame, masked unless masked is false
+func (c *wsTestClient) writeFrame(fin bool, opcode int, payload []byte, masked bool) {
+	c.t.Helper()
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	if masked {
+		mask := []byte{0x12, 0x34, 0x56, 0x78}
+		frame = append(frame, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// readFrame reads one unmasked server frame
+func (c *wsTestClient) readFrame() (int, []byte) {
+	c.t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		c.t.Fatalf("server frame %x: want fin set and no mask", header)
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		io.ReadFull(c.reader, extended[:])
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		io.ReadFull(c.reader, extended[:])
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	return int(header[0] & 0x0F), payload
+}
+
+// expectClose reads a close frame with code
+func (c *wsTestClient) expectClose(code int) {
+	c.t.Helper()
+	opcode, payload := c.readFrame()
+	if opcode != wsClose || len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != code {
+		c.t.Fatalf("got opcode %d payload %q, want close %d", opcode, payload, code)
+	}
+}
+
+// newEchoServer echoes every message back until ReadMessage fails
+func newEchoServer(t *testing.T, maxMessage int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgradeWebSocket(w, r, maxMessage)
+		if err != nil {
+			return
+		}
+		for {
+			_, data, err := conn.ReadMessage(5 * time.Second)
+			if err != nil {
+				return
+			}
+			conn.WriteText(data)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	client := dialWebSocket(t, newEchoServer(t, 1<<20))
+
+	client.writeFrame(true, wsText, []byte("hallo"), true)
+	if opcode, payload := client.readFrame(); opcode != wsText || string(payload) != "hallo" {
+		t.Fatalf("got %d %q", opcode, payload)
+	}
+
+	// Lengths with 16 and 64 bit extended headers
+	for _, size := range []int{300, 70000} {
+		message := bytes.Repeat([]byte("ä"), size/2)
+		client.writeFrame(true, wsText, message, true)
+		if _, payload := client.readFrame(); !bytes.Equal(payload, message) {
+			t.Fatalf("%d bytes: echo has %d bytes", len(message), len(payload))
+		}
+	}
+}
+
+func TestWebSocketFragmentsAndPing(t *testing.T) {
+	client := dialWebSocket(t, newEchoServer(t, 1<<20))
+
+	client.writeFrame(false, wsText, []byte("ein "), true)
+	client.writeFrame(true, wsPing, []byte("da?"), true)
+	client.writeFrame(false, wsContinuation, []byte("geteilter "), true)
+	client.writeFrame(true, wsContinuation, []byte("Text"), true)
+
+	if opcode, payload := client.readFrame(); opcode != wsPong || string(payload) != "da?" {
+		t.Fatalf("got %d %q, want the pong first", opcode, payload)
+	}
+	if opcode, payload := client.readFrame(); opcode != wsText || string(payload) != "ein geteilter Text" {
+		t.Fatalf("got %d %q", opcode, payload)
+	}
+
+	// UTF-8 is checked on the whole message, not per fragment
+	client.writeFrame(false, wsText, []byte{0xc3}, true)
+	client.writeFrame(true, wsContinuation, []byte{0xa4}, true)
+	if opcode, payload := client.readFrame(); opcode != wsText || string(payload) != "ä" {
+		t.Fatalf("got %d %q", opcode, payload)
+	}
+}
+
+func TestWebSocketClose(t *testing.T) {
+	client := dialWebSocket(t, newEchoServer(t, 1<<20))
+	client.writeFrame(true, wsClose, binary.BigEndian.AppendUint16(nil, WS_CLOSE_GOING_AWAY), true)
+	client.expectClose(WS_CLOSE_GOING_AWAY)
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames func(c *wsTestClient)
+		code   int
+	}{
+		{"unmasked", func(c *wsTestClient) {
+			c.writeFrame(true, wsText, []byte("x"), false)
+		}, WS_CLOSE_PROTOCOL},
+		{"continuation first", func(c *wsTestClient) {
+			c.writeFrame(true, wsContinuation, []byte("x"), true)
+		}, WS_CLOSE_PROTOCOL},
+		{"text inside a fragmented message", func(c *wsTestClient) {
+			c.writeFrame(false, wsText, []byte("x"), true)
+			c.writeFrame(true, wsText, []byte("y"), true)
+		}, WS_CLOSE_PROTOCOL},
+		{"fragmented ping", func(c *wsTestClient) {
+			c.writeFrame(false, wsPing, nil, true)
+		}, WS_CLOSE_PROTOCOL},
+		{"unknown opcode", func(c *wsTestClient) {
+			c.writeFrame(true, 0x3, nil, true)
+		}, WS_CLOSE_PROTOCOL},
+		{"oversized frame", func(c *wsTestClient) {
+			c.writeFrame(true, wsText, []byte(strings.Repeat("x", 65)), true)
+		}, WS_CLOSE_TOO_BIG},
+		{"oversized message", func(c *wsTestClient) {
+			c.writeFrame(false, wsText, []byte(strings.Repeat("x", 40)), true)
+			c.writeFrame(true, wsContinuation, []byte(strings.Repeat("x", 40)), true)
+		}, WS_CLOSE_TOO_BIG},
+		{"invalid UTF-8", func(c *wsTestClient) {
+			c.writeFrame(true, wsText, []byte{'a', 0xff}, true)
+		}, WS_CLOSE_INVALID_DATA},
+		{"UTF-8 split across fragments", func(c *wsTestClient) {
+			c.writeFrame(false, wsText, []byte{0xc3}, true)
+			c.writeFrame(true, wsContinuation, []byte{'a'}, true)
+		}, WS_CLOSE_INVALID_DATA},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := dialWebSocket(t, newEchoServer(t, 64))
+			test.frames(client)
+			client.expectClose(test.code)
+		})
+	}
+}
+
+func TestWebSocketRejectsPlainRequests(t *testing.T) {
+	server := newEchoServer(t, 64)
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got %s, want 400", response.Status)
+	}
+}
@@ -75,6 +75,34 @@ function AppContent() {
     }
   };
 
+  const formatGermanHtml = async () => {
+    if (!germanHtml.trim()) {
+      return;
+    }
+
+    setError("");
+
+    try {
+      const response = await fetch(`${API_BASE}/format`, {
+        method: "POST",
+        headers: {
+          "Content-Type": "application/json",
+        },
+        body: JSON.stringify({ content: germanHtml }),
+      });
+
+      const data: TranspileResponse = await response.json();
+
+      if (!response.ok || data.error) {
+        throw new Error(data.error || "Failed to format");
+      }
+
+      setGermanHtml(data.result || germanHtml);
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "An error occurred");
+    }
+  };
+
   const clearAll = () => {
     setGermanHtml("");
     setStandardHtml("");
@@ -134,6 +162,13 @@ function AppContent() {
             >
               {isLoading ? "Transpiling..." : "Transpile HTML"}
             </button>
+            <button
+              onClick={formatGermanHtml}
+              disabled={isLoading || !germanHtml.trim()}
+              className="px-6 py-3 bg-gray-200 text-gray-700 rounded-lg hover:bg-gray-300 disabled:bg-gray-100 disabled:text-gray-400 disabled:cursor-not-allowed transition-colors"
+            >
+              Format
+            </button>
             <button
               onClick={clearAll}
               className="px-6 py-3 bg-gray-500 text-white rounded-lg hover:bg-gray-600 transition-colors"